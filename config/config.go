@@ -0,0 +1,371 @@
+// Package config reads the server settings from a YAML, TOML or JSON file,
+// checked against the schema of File, and from the SSH_* environment
+// variables.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-executor/inventory"
+	"ssh-executor/mcp"
+	"ssh-executor/policy"
+)
+
+// File holds every server setting. Fields tagged secret:"true" are hidden
+// by Redacted.
+type File struct {
+	Transport  string              `json:"transport,omitempty" enum:"ssh|local" description:"Run commands over SSH (default) or on the server's own machine"`
+	SSH        SSH                 `json:"ssh,omitempty" description:"Default host and authentication"`
+	Inventory  string              `json:"inventory,omitempty" description:"Inventory file, YAML or Ansible-style INI"`
+	Hosts      map[string]Host     `json:"hosts,omitempty" description:"Inventory hosts by name, added to those of the inventory file"`
+	Groups     map[string][]string `json:"groups,omitempty" description:"Extra host groups listing host names or addresses"`
+	Sudo       Sudo                `json:"sudo,omitempty"`
+	Policy     Policy              `json:"policy,omitempty" description:"Commands that need approval or are refused"`
+	Redact     Redact              `json:"redact,omitempty" description:"Secret detection in results"`
+	Timeouts   Timeouts            `json:"timeouts,omitempty"`
+	Limits     Limits              `json:"limits,omitempty"`
+	Pool       Pool                `json:"pool,omitempty" description:"Connections opened per host to run commands at once"`
+	Audit      Audit               `json:"audit,omitempty"`
+	Logging    Logging             `json:"logging,omitempty"`
+	PromptsDir string              `json:"prompts_dir,omitempty" description:"Directory of extra runbook prompts"`
+}
+
+type SSH struct {
+	Host                string              `json:"host,omitempty"`
+	Port                int                 `json:"port,omitempty" minimum:"1" maximum:"65535"`
+	User                string              `json:"user,omitempty"`
+	Password            string              `json:"password,omitempty" secret:"true"`
+	Key                 string              `json:"key,omitempty" description:"Private key file"`
+	Certificate         string              `json:"certificate,omitempty" description:"OpenSSH certificate for key; defaults to <key>-cert.pub if it exists"`
+	HostCAKeys          string              `json:"host_ca_keys,omitempty" description:"File of CA keys that must have signed the host certificates"`
+	KeyboardInteractive KeyboardInteractive `json:"keyboard_interactive,omitempty"`
+}
+
+type KeyboardInteractive struct {
+	Responses      map[string]string `json:"responses,omitempty" secret:"true" description:"Answers by prompt substring"`
+	TOTPSecret     string            `json:"totp_secret,omitempty" secret:"true" description:"Base32 secret for one-time password prompts"`
+	TOTPSecretFile string            `json:"totp_secret_file,omitempty"`
+}
+
+type Host struct {
+	Address string              `json:"address,omitempty" description:"Defaults to the host name"`
+	User    string              `json:"user,omitempty"`
+	Port    int                 `json:"port,omitempty" minimum:"1" maximum:"65535"`
+	Key     string              `json:"key,omitempty"`
+	Jump    string              `json:"jump,omitempty" description:"Host to connect through"`
+	Groups  []string            `json:"groups,omitempty"`
+	Tags    map[string]string   `json:"tags,omitempty"`
+	Tools   map[string]HostTool `json:"tools,omitempty" description:"Fixed commands offered as tools while the host is connected"`
+}
+
+type HostTool struct {
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command"`
+}
+
+type Sudo struct {
+	Password     string `json:"password,omitempty" secret:"true"`
+	PasswordFile string `json:"password_file,omitempty"`
+}
+
+type Policy struct {
+	File  string `json:"file,omitempty" description:"YAML file of rules"`
+	Rules []Rule `json:"rules,omitempty" description:"Rules checked before those of the file and the built-in ones"`
+}
+
+type Rule struct {
+	Name    string `json:"name,omitempty"`
+	Pattern string `json:"pattern" description:"Regular expression matched against the command"`
+	Action  string `json:"action,omitempty" enum:"confirm|deny"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type Redact struct {
+	File string `json:"file,omitempty" description:"YAML file of extra or disabled detectors"`
+}
+
+type Timeouts struct {
+	Connect Duration `json:"connect,omitempty" format:"duration" description:"Limit on opening a connection, e.g. 15s"`
+	Command Duration `json:"command,omitempty" format:"duration" description:"Default limit on a command or script run"`
+}
+
+type Limits struct {
+	MaxOutputBytes   int `json:"max_output_bytes,omitempty" minimum:"1" description:"Bytes kept of each of stdout and stderr (default 1 MiB)"`
+	FleetConcurrency int `json:"fleet_concurrency,omitempty" minimum:"1" description:"Default number of hosts execute_on_hosts runs on at once (default 10)"`
+}
+
+type Pool struct {
+	MaxConnections int      `json:"max_connections,omitempty" minimum:"1" description:"Connections per host, the first included (default 4); hosts whose login needs a TOTP code or an answer from the user keep to one"`
+	MaxSessions    int      `json:"max_sessions,omitempty" minimum:"1" description:"Commands run at once over one connection; keep at or below the server's MaxSessions (default 10)"`
+	QueueTimeout   Duration `json:"queue_timeout,omitempty" format:"duration" description:"How long a command waits for a free session (default 30s)"`
+	IdleTimeout    Duration `json:"idle_timeout,omitempty" format:"duration" description:"Close extra connections unused for this long (default 5m)"`
+}
+
+type Audit struct {
+	File string `json:"file,omitempty" description:"File receiving a JSON line per command checked against the policy"`
+}
+
+type Logging struct {
+	Level string `json:"level,omitempty" enum:"debug|info|notice|warning|error|critical|alert|emergency"`
+	File  string `json:"file,omitempty" description:"File mirroring the log instead of stderr"`
+}
+
+// Duration is a Go duration string such as "30s" or "5m".
+type Duration string
+
+// Value returns d as a time.Duration, 0 if unset.
+func (d Duration) Value() time.Duration {
+	v, _ := time.ParseDuration(string(d))
+	return v
+}
+
+// Schema returns the JSON schema config files are checked against.
+func Schema() map[string]interface{} {
+	return mcp.SchemaFor[File]()
+}
+
+// Load reads a config file. The extension selects the format: .yaml, .yml,
+// .toml or .json. Every problem found is reported as an Errors.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse decodes data in the format named by the extension of path, which is
+// also used in error messages.
+func Parse(path string, data []byte) (*File, error) {
+	var doc *document
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		doc, err = parseYAML(data)
+	case ".toml":
+		doc, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q; use .yaml, .toml or .json", path, ext)
+	}
+	var located Error
+	if errors.As(err, &located) {
+		located.File = path
+		return nil, located
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	v := &validator{doc: doc, file: path}
+	v.value(Schema(), doc.root, "")
+	if err := v.errors(); err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(doc.root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.check(v)
+	if err := v.errors(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// check reports what the schema cannot express.
+func (f *File) check(v *validator) {
+	for i, r := range f.Policy.Rules {
+		if _, err := policy.NewRule(r.Name, r.Pattern, policy.Action(r.Action), r.Reason); err != nil {
+			v.report(fmt.Sprintf("policy.rules[%d].pattern", i), err.Error())
+		}
+	}
+}
+
+// InventoryHosts returns the hosts defined in the file itself.
+func (f *File) InventoryHosts() []*inventory.Host {
+	var hosts []*inventory.Host
+	for _, name := range sortedKeys(f.Hosts) {
+		h := f.Hosts[name]
+		host := &inventory.Host{
+			Name:    name,
+			Address: h.Address,
+			User:    h.User,
+			Port:    h.Port,
+			KeyPath: h.Key,
+			Jump:    h.Jump,
+			Groups:  append([]string(nil), h.Groups...),
+			Tags:    map[string]string{},
+		}
+		for k, v := range h.Tags {
+			host.Tags[k] = v
+		}
+		for _, tool := range sortedKeys(h.Tools) {
+			host.Tools = append(host.Tools, inventory.Tool{Name: tool, Description: h.Tools[tool].Description, Command: h.Tools[tool].Command})
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// FromEnv returns the settings given by the SSH_* environment variables.
+// SSH_GROUP_<NAME>=host1,host2 variables define groups with lower-cased
+// names.
+func FromEnv() (*File, error) {
+	f := &File{
+		Transport: os.Getenv("SSH_TRANSPORT"),
+		SSH: SSH{
+			Host:        os.Getenv("SSH_HOST"),
+			User:        os.Getenv("SSH_USER"),
+			Password:    os.Getenv("SSH_PASSWORD"),
+			Key:         os.Getenv("SSH_PRIVATE_KEY_PATH"),
+			Certificate: os.Getenv("SSH_CERTIFICATE_PATH"),
+			HostCAKeys:  os.Getenv("SSH_HOST_CA_KEYS"),
+			KeyboardInteractive: KeyboardInteractive{
+				TOTPSecret:     os.Getenv("SSH_TOTP_SECRET"),
+				TOTPSecretFile: os.Getenv("SSH_TOTP_SECRET_FILE"),
+			},
+		},
+		Inventory:  os.Getenv("SSH_INVENTORY"),
+		Sudo:       Sudo{Password: os.Getenv("SSH_SUDO_PASSWORD"), PasswordFile: os.Getenv("SSH_SUDO_PASSWORD_FILE")},
+		Policy:     Policy{File: os.Getenv("SSH_POLICY_FILE")},
+		Redact:     Redact{File: os.Getenv("SSH_REDACT_FILE")},
+		Logging:    Logging{Level: os.Getenv("SSH_LOG_LEVEL"), File: os.Getenv("SSH_LOG_FILE")},
+		PromptsDir: os.Getenv("SSH_PROMPTS_DIR"),
+	}
+	if v := os.Getenv("SSH_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("SSH_PORT: invalid port %q", v)
+		}
+		f.SSH.Port = port
+	}
+	if v := os.Getenv("SSH_KBD_INTERACTIVE_RESPONSES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &f.SSH.KeyboardInteractive.Responses); err != nil {
+			return nil, fmt.Errorf("SSH_KBD_INTERACTIVE_RESPONSES: %w", err)
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		group, ok := strings.CutPrefix(name, "SSH_GROUP_")
+		if !ok || group == "" {
+			continue
+		}
+		group = strings.ToLower(group)
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				if f.Groups == nil {
+					f.Groups = map[string][]string{}
+				}
+				f.Groups[group] = append(f.Groups[group], host)
+			}
+		}
+	}
+	return f, nil
+}
+
+// Merge fills the settings f leaves unset from other. Maps gain the keys
+// they lack.
+func (f *File) Merge(other *File) {
+	fillZero(reflect.ValueOf(f).Elem(), reflect.ValueOf(other).Elem())
+}
+
+func fillZero(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			fillZero(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			if !dst.MapIndex(iter.Key()).IsValid() {
+				dst.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+	default:
+		if dst.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// redactedValue replaces secrets in Redacted copies.
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy of f with the values of secret fields replaced.
+func (f *File) Redacted() *File {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return &File{}
+	}
+	var out File
+	if err := json.Unmarshal(data, &out); err != nil {
+		return &File{}
+	}
+	redactSecrets(reflect.ValueOf(&out).Elem())
+	return &out
+}
+
+func redactSecrets(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if v.Type().Field(i).Tag.Get("secret") != "true" {
+				redactSecrets(field)
+				continue
+			}
+			switch field.Kind() {
+			case reflect.String:
+				if field.String() != "" {
+					field.SetString(redactedValue)
+				}
+			case reflect.Map:
+				iter := field.MapRange()
+				for iter.Next() {
+					field.SetMapIndex(iter.Key(), reflect.ValueOf(redactedValue))
+				}
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			redactSecrets(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			redactSecrets(elem)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const yamlConfig = `
+transport: ssh
+ssh:
+  host: 10.0.0.5
+  user: deploy
+  password: hunter2
+  keyboard_interactive:
+    responses: {"Verification code": "123456"}
+hosts:
+  web1.example.com:
+    user: www
+    groups: [web]
+    tools:
+      web1_status:
+        command: systemctl status nginx
+policy:
+  rules:
+    - name: no-curl
+      pattern: curl
+      action: deny
+timeouts:
+  connect: 15s
+limits:
+  max_output_bytes: 4096
+pool:
+  idle_timeout: 1m
+`
+
+func TestParseFormats(t *testing.T) {
+	tomlConfig := `
+transport = "ssh"
+[ssh]
+host = "10.0.0.5"
+user = "deploy"
+password = "hunter2"
+[ssh.keyboard_interactive.responses]
+"Verification code" = "123456"
+[hosts."web1.example.com"]
+user = "www"
+groups = ["web"]
+[hosts."web1.example.com".tools.web1_status]
+command = "systemctl status nginx"
+[[policy.rules]]
+name = "no-curl"
+pattern = "curl"
+action = "deny"
+[timeouts]
+connect = "15s"
+[limits]
+max_output_bytes = 4096
+[pool]
+idle_timeout = "1m"
+`
+	jsonConfig := `{
+  "transport": "ssh",
+  "ssh": {"host": "10.0.0.5", "user": "deploy", "password": "hunter2",
+          "keyboard_interactive": {"responses": {"Verification code": "123456"}}},
+  "hosts": {"web1.example.com": {"user": "www", "groups": ["web"],
+            "tools": {"web1_status": {"command": "systemctl status nginx"}}}},
+  "policy": {"rules": [{"name": "no-curl", "pattern": "curl", "action": "deny"}]},
+  "timeouts": {"connect": "15s"},
+  "limits": {"max_output_bytes": 4096},
+  "pool": {"idle_timeout": "1m"}
+}`
+	for name, data := range map[string]string{"c.yaml": yamlConfig, "c.toml": tomlConfig, "c.json": jsonConfig} {
+		f, err := Parse(name, []byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if f.SSH.Host != "10.0.0.5" || f.SSH.KeyboardInteractive.Responses["Verification code"] != "123456" {
+			t.Errorf("%s: ssh = %+v", name, f.SSH)
+		}
+		if f.Timeouts.Connect.Value() != 15*time.Second || f.Limits.MaxOutputBytes != 4096 || f.Pool.IdleTimeout.Value() != time.Minute {
+			t.Errorf("%s: timeouts = %+v, limits = %+v, pool = %+v", name, f.Timeouts, f.Limits, f.Pool)
+		}
+		if len(f.Policy.Rules) != 1 || f.Policy.Rules[0].Action != "deny" {
+			t.Errorf("%s: rules = %+v", name, f.Policy.Rules)
+		}
+		hosts := f.InventoryHosts()
+		if len(hosts) != 1 || hosts[0].Name != "web1.example.com" || len(hosts[0].Tools) != 1 || hosts[0].Tools[0].Name != "web1_status" {
+			t.Errorf("%s: hosts = %+v", name, hosts)
+		}
+	}
+}
+
+func TestParseErrorLocations(t *testing.T) {
+	data := `ssh:
+  port: 70000
+  usr: deploy
+hosts:
+  db1:
+    tools:
+      db1_backup:
+        description: Back up
+policy:
+  rules:
+    - pattern: "("
+timeouts:
+  command: soon
+limits:
+  fleet_concurrency: many
+`
+	_, err := Parse("server.yaml", []byte(data))
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want Errors", err)
+	}
+	want := []string{
+		"server.yaml:2:3: ssh.port: must be at most 65535",
+		"server.yaml:3:3: ssh.usr: unknown key",
+		`server.yaml:7:7: hosts.db1.tools.db1_backup: missing required key "command"`,
+		"server.yaml:13:3: timeouts.command: expected a duration such as 30s or 5m, got \"soon\"",
+		"server.yaml:15:3: limits.fleet_concurrency: expected an integer, got a string",
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("errors:\n%s\nwant:\n%s", err, strings.Join(want, "\n"))
+	}
+
+	// Patterns are only compiled once the file matches the schema.
+	_, err = Parse("server.yaml", []byte("policy:\n  rules:\n    - pattern: \"(\"\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "server.yaml:3:7: policy.rules[0].pattern: error parsing regexp") {
+		t.Errorf("err = %v", err)
+	}
+
+	_, err = Parse("server.toml", []byte("[ssh]\nport = \"22\"\n"))
+	if err == nil || err.Error() != "server.toml: ssh.port: expected an integer, got a string" {
+		t.Errorf("toml err = %v", err)
+	}
+	_, err = Parse("server.toml", []byte("[ssh\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "server.toml:2:5: ") {
+		t.Errorf("toml syntax err = %v", err)
+	}
+	if _, err := Parse("server.ini", nil); err == nil {
+		t.Error("unknown extension accepted")
+	}
+}
+
+func TestMergeAndRedact(t *testing.T) {
+	t.Setenv("SSH_HOST", "env-host")
+	t.Setenv("SSH_PORT", "2222")
+	t.Setenv("SSH_SUDO_PASSWORD", "sudo-secret")
+	t.Setenv("SSH_GROUP_DB", "db1, db2")
+	env, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse("c.yaml", []byte(yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Merge(env)
+	if f.SSH.Host != "10.0.0.5" || f.SSH.Port != 2222 || f.Sudo.Password != "sudo-secret" {
+		t.Errorf("merged ssh = %+v, sudo = %+v", f.SSH, f.Sudo)
+	}
+	if got := f.Groups["db"]; len(got) != 2 || got[1] != "db2" {
+		t.Errorf("groups = %v", f.Groups)
+	}
+
+	r := f.Redacted()
+	if r.SSH.Password != "[REDACTED]" || r.Sudo.Password != "[REDACTED]" || r.SSH.KeyboardInteractive.Responses["Verification code"] != "[REDACTED]" {
+		t.Errorf("redacted = %+v", r)
+	}
+	if r.SSH.User != "deploy" || f.SSH.Password != "hunter2" {
+		t.Errorf("redaction changed other values: %q, %q", r.SSH.User, f.SSH.Password)
+	}
+
+	t.Setenv("SSH_PORT", "ssh")
+	if _, err := FromEnv(); err == nil {
+		t.Error("bad SSH_PORT accepted")
+	}
+}
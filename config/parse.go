@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// document is a decoded config file as generic JSON-like values, with the
+// position of each key where the format provides one.
+type document struct {
+	root interface{}
+	pos  map[string]position
+}
+
+type position struct {
+	line, column int
+}
+
+func parseYAML(data []byte) (*document, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, Error{Line: line, Message: m[2]}
+		}
+		return nil, err
+	}
+	doc := &document{root: map[string]interface{}{}, pos: map[string]position{}}
+	if len(node.Content) == 0 {
+		return doc, nil
+	}
+	root, err := doc.yamlValue(node.Content[0], "")
+	if err != nil {
+		return nil, err
+	}
+	doc.root = root
+	return doc, nil
+}
+
+func (d *document) yamlValue(n *yaml.Node, path string) (interface{}, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return d.yamlValue(n.Alias, path)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				return nil, Error{Line: k.Line, Column: k.Column, Message: "keys must be strings"}
+			}
+			p := joinPath(path, k.Value)
+			if _, dup := m[k.Value]; dup {
+				return nil, Error{Line: k.Line, Column: k.Column, Path: p, Message: "duplicate key"}
+			}
+			d.pos[p] = position{k.Line, k.Column}
+			value, err := d.yamlValue(v, p)
+			if err != nil {
+				return nil, err
+			}
+			m[k.Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		list := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			d.pos[p] = position{item.Line, item.Column}
+			value, err := d.yamlValue(item, p)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	}
+	if n.Tag == "!!timestamp" {
+		return n.Value, nil
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, Error{Line: n.Line, Column: n.Column, Path: path, Message: err.Error()}
+	}
+	return v, nil
+}
+
+// yamlErrorLine extracts the line from yaml.v3 syntax errors.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// parseTOML decodes a TOML file. TOML keys carry no positions, so errors
+// past parsing name only the key.
+func parseTOML(data []byte) (*document, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(string(data), &m); err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, Error{Line: pe.Position.Line, Column: pe.Position.Col, Message: pe.Message}
+		}
+		return nil, err
+	}
+	return &document{root: tomlValue(m), pos: map[string]position{}}, nil
+}
+
+func tomlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = tomlValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = tomlValue(item)
+		}
+		return list
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tomlValue(item)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return v
+}
+
+// joinPath appends key to a dotted key path, quoting keys that contain
+// dots, such as host names.
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]\" ") || key == "" {
+		key = strconv.Quote(key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
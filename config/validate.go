@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Error is a problem at one place in a config file. Line and Column are 0
+// when the format does not give them.
+type Error struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, e.Line)
+	}
+	if e.Line > 0 && e.Column > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, e.Column)
+	}
+	if e.Path == "" {
+		return loc + ": " + e.Message
+	}
+	return loc + ": " + e.Path + ": " + e.Message
+}
+
+// Errors lists every problem found in a config file, in file order where
+// positions are known.
+type Errors []Error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator checks a document against a JSON schema as generated by
+// mcp.SchemaFor, collecting every violation.
+type validator struct {
+	doc  *document
+	file string
+	errs Errors
+}
+
+func (v *validator) report(path, format string, args ...interface{}) {
+	pos := v.doc.pos[path]
+	v.errs = append(v.errs, Error{File: v.file, Line: pos.line, Column: pos.column, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// errors returns the problems found in file order, or nil.
+func (v *validator) errors() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Line < v.errs[j].Line
+	})
+	return v.errs
+}
+
+func (v *validator) value(schema map[string]interface{}, value interface{}, path string) {
+	if value == nil {
+		return
+	}
+	switch schema["type"] {
+	case "object":
+		v.object(schema, value, path)
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			v.report(path, "expected a list, got %s", kind(value))
+			return
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range list {
+			v.value(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.report(path, "expected a string, got %s", kind(value))
+			return
+		}
+		if enum, ok := schema["enum"].([]string); ok && !contains(enum, s) {
+			v.report(path, "must be one of %s, got %q", strings.Join(enum, ", "), s)
+		}
+		if schema["format"] == "duration" {
+			if d, err := time.ParseDuration(s); err != nil || d < 0 {
+				v.report(path, "expected a duration such as 30s or 5m, got %q", s)
+			}
+		}
+	case "integer":
+		n, ok := number(value)
+		if !ok {
+			v.report(path, "expected an integer, got %s", kind(value))
+			return
+		}
+		if n != math.Trunc(n) {
+			v.report(path, "expected an integer, got %v", n)
+			return
+		}
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			v.report(path, "must be at least %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && n > max {
+			v.report(path, "must be at most %v", max)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.report(path, "expected true or false, got %s", kind(value))
+		}
+	}
+}
+
+func (v *validator) object(schema map[string]interface{}, value interface{}, path string) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		v.report(path, "expected a mapping, got %s", kind(value))
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, _ := schema["additionalProperties"].(map[string]interface{})
+	for _, k := range keys {
+		p := joinPath(path, k)
+		switch {
+		case properties[k] != nil:
+			v.value(properties[k].(map[string]interface{}), m[k], p)
+		case additional != nil:
+			v.value(additional, m[k], p)
+		default:
+			v.report(p, "unknown key")
+		}
+	}
+	required, _ := schema["required"].([]string)
+	for _, k := range required {
+		if m[k] == nil {
+			v.report(path, "missing required key %q", k)
+		}
+	}
+}
+
+// number returns the value of a decoded YAML, TOML or JSON number.
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// kind names the type of a decoded value for error messages.
+func kind(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, uint64, float64:
+		return "a number"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a mapping"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"ssh-executor/shell"
+)
+
+// ArgvRunner is implemented by executors that can start a program directly,
+// without a shell parsing its arguments.
+type ArgvRunner interface {
+	RunArgv(ctx context.Context, argv []string, opts RunOptions) (*Result, error)
+}
+
+// RunArgv runs argv[0] with the remaining words as its arguments. Executors
+// that cannot bypass the shell, such as SSH where the remote login shell
+// always parses the command, get argv quoted word by word and exec'd, so the
+// shell performs no expansion and does not stay around.
+func RunArgv(ctx context.Context, e Executor, argv []string, opts RunOptions) (*Result, error) {
+	if len(argv) == 0 || argv[0] == "" {
+		return nil, fmt.Errorf("argv needs a program")
+	}
+	if r, ok := e.(ArgvRunner); ok {
+		return r.RunArgv(ctx, argv, opts)
+	}
+	return e.Run(ctx, "exec "+shell.Join(argv), opts)
+}
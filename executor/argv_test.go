@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunArgv(t *testing.T) {
+	argv := []string{"printf", "%s|", "it's $HOME", "*", ""}
+	want := "it's $HOME|*||"
+
+	res, err := RunArgv(context.Background(), NewLocalExecutor(), argv, RunOptions{})
+	if err != nil || res.Stdout != want {
+		t.Errorf("local: %+v, %v", res, err)
+	}
+
+	f := NewFake(nil)
+	f.Connect(context.Background())
+	if _, err := RunArgv(context.Background(), f, argv, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Commands[0]; got != `exec printf '%s|' 'it'\''s $HOME' '*' ''` {
+		t.Errorf("fake ran %s", got)
+	}
+
+	if _, err := RunArgv(context.Background(), f, nil, RunOptions{}); err == nil {
+		t.Error("empty argv accepted")
+	}
+}
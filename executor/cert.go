@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// certTimeFormat is used for certificate validity windows in errors.
+const certTimeFormat = "2006-01-02 15:04:05 MST"
+
+// userCertSigner loads the OpenSSH user certificate for signer from
+// certPath, or from keyPath + "-cert.pub" when certPath is empty, and returns
+// a signer presenting it. It returns nil when there is no certificate.
+func userCertSigner(signer ssh.Signer, keyPath, certPath string, now time.Time) (ssh.Signer, error) {
+	if certPath == "" {
+		certPath = keyPath + "-cert.pub"
+		if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(expandHome(certPath))
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certPath, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an OpenSSH certificate", certPath)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s: not a user certificate", certPath)
+	}
+	if err := checkValidity(cert, now); err != nil {
+		return nil, fmt.Errorf("%s: %w", certPath, err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certPath, err)
+	}
+	return certSigner, nil
+}
+
+// checkValidity rejects a certificate outside its validity window.
+func checkValidity(cert *ssh.Certificate, now time.Time) error {
+	unix := uint64(now.Unix())
+	if unix >= cert.ValidAfter && (cert.ValidBefore == ssh.CertTimeInfinity || unix < cert.ValidBefore) {
+		return nil
+	}
+	from := "the beginning of time"
+	if cert.ValidAfter != 0 {
+		from = time.Unix(int64(cert.ValidAfter), 0).UTC().Format(certTimeFormat)
+	}
+	until := "forever"
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		until = time.Unix(int64(cert.ValidBefore), 0).UTC().Format(certTimeFormat)
+	}
+	state := "has expired"
+	if unix < cert.ValidAfter {
+		state = "is not yet valid"
+	}
+	return fmt.Errorf("certificate %q %s: valid from %s until %s", cert.KeyId, state, from, until)
+}
+
+// hostAuthority is a CA trusted to sign host certificates for hosts matching
+// one of its patterns; no patterns means any host.
+type hostAuthority struct {
+	key      ssh.PublicKey
+	patterns []string
+}
+
+// loadHostAuthorities reads CA keys from path, either as plain public keys or
+// as known_hosts "@cert-authority <patterns> <key>" lines.
+func loadHostAuthorities(file string) ([]hostAuthority, error) {
+	data, err := os.ReadFile(expandHome(file))
+	if err != nil {
+		return nil, err
+	}
+	var cas []hostAuthority
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "@") {
+			marker, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+			}
+			if marker != "cert-authority" {
+				continue
+			}
+			cas = append(cas, hostAuthority{key: key, patterns: hosts})
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+		cas = append(cas, hostAuthority{key: key})
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("%s: no CA keys", file)
+	}
+	return cas, nil
+}
+
+// hostCertCallback accepts only host certificates signed by one of cas for
+// the host being dialled.
+func hostCertCallback(cas []hostAuthority) ssh.HostKeyCallback {
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			for _, ca := range cas {
+				if bytes.Equal(ca.key.Marshal(), auth.Marshal()) && matchHost(ca.patterns, host) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if _, ok := key.(*ssh.Certificate); !ok {
+			return fmt.Errorf("host %s presented a plain %s key, but a certificate signed by a trusted CA is required", hostname, key.Type())
+		}
+		return checker.CheckHostKey(hostname, remote, key)
+	}
+}
+
+func matchHost(patterns []string, host string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"ssh-executor/internal/sshtest"
+)
+
+func TestUserCertificate(t *testing.T) {
+	ca, _ := sshtest.GenerateKey(t)
+	key, keyPath := sshtest.GenerateKey(t)
+	srv := sshtest.Start(t, sshtest.Config{UserCA: ca.PublicKey()})
+	cfg := SSHConfig{Host: srv.Host, Port: srv.Port, User: "test", KeyPath: keyPath}
+
+	// The plain key alone is not authorized.
+	if err := NewSSHExecutor(cfg).Connect(context.Background()); err == nil {
+		t.Fatal("connected without a certificate")
+	}
+
+	now := time.Now()
+	sshtest.WriteUserCert(t, ca, key, keyPath, []string{"test"}, now.Add(-time.Hour), now.Add(time.Hour))
+	exec := NewSSHExecutor(cfg)
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatalf("connect with certificate: %v", err)
+	}
+	exec.Close()
+
+	sshtest.WriteUserCert(t, ca, key, keyPath, []string{"test"}, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	err := NewSSHExecutor(cfg).Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "has expired: valid from 2024-01-01 00:00:00 UTC until 2024-01-02 00:00:00 UTC") {
+		t.Errorf("expired certificate: %v", err)
+	}
+}
+
+func TestHostCertificate(t *testing.T) {
+	ca, _ := sshtest.GenerateKey(t)
+	other, _ := sshtest.GenerateKey(t)
+	dir := t.TempDir()
+	writeCAs := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	trusted := writeCAs("trusted", "# host CAs\n@cert-authority 127.0.0.* "+string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	wrongHost := writeCAs("wrong-host", "@cert-authority *.example.com "+string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	untrusted := writeCAs("untrusted", string(ssh.MarshalAuthorizedKey(other.PublicKey())))
+
+	srv := sshtest.Start(t, sshtest.Config{Password: "pw", HostCA: ca})
+	plain := sshtest.Start(t, sshtest.Config{Password: "pw"})
+	connect := func(srv *sshtest.Server, caPath string) error {
+		exec := NewSSHExecutor(SSHConfig{Host: srv.Host, Port: srv.Port, User: "test", Password: "pw", HostCAPath: caPath})
+		defer exec.Close()
+		return exec.Connect(context.Background())
+	}
+
+	if err := connect(srv, trusted); err != nil {
+		t.Errorf("trusted CA: %v", err)
+	}
+	if err := connect(srv, wrongHost); err == nil {
+		t.Error("CA restricted to other hosts was accepted")
+	}
+	if err := connect(srv, untrusted); err == nil {
+		t.Error("untrusted CA was accepted")
+	}
+	if err := connect(plain, trusted); err == nil || !strings.Contains(err.Error(), "certificate signed by a trusted CA is required") {
+		t.Errorf("plain host key: %v", err)
+	}
+}
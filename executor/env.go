@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ssh-executor/shell"
+)
+
+// CheckEnv rejects names that are not valid POSIX shell variable names.
+func CheckEnv(env map[string]string) error {
+	for name := range env {
+		if !validEnvName(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ShellPrefix returns POSIX shell lines that export env and change to dir,
+// for prepending to a command. The command does not run if cd fails.
+func ShellPrefix(env map[string]string, dir string) string {
+	var b strings.Builder
+	if len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("export")
+		for _, name := range names {
+			fmt.Fprintf(&b, " %s=%s", name, shell.Quote(env[name]))
+		}
+		b.WriteString("\n")
+	}
+	if dir != "" {
+		fmt.Fprintf(&b, "cd %s || exit\n", shell.Quote(dir))
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+// Package executor runs commands and transfers files on a target host.
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+var ErrNotConnected = errors.New("not connected")
+
+// Executor is an execution backend. Run reports a non-zero exit status in
+// Result.ExitCode; the returned error is reserved for failures to run the
+// command at all.
+type Executor interface {
+	Connect(ctx context.Context) error
+	Run(ctx context.Context, cmd string, opts RunOptions) (*Result, error)
+	Upload(ctx context.Context, path string, data []byte, mode os.FileMode) error
+	Download(ctx context.Context, path string) ([]byte, error)
+	Close() error
+}
+
+// Pooler is implemented by executors that spread commands over several
+// connections to their host.
+type Pooler interface {
+	PoolStats() PoolStats
+}
+
+// Tunneler is implemented by executors that can carry TCP connections to
+// and from the target host.
+type Tunneler interface {
+	// Dial connects to addr from the target host.
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+	// Listen listens on addr on the target host.
+	Listen(addr string) (net.Listener, error)
+	// Done is closed when the connection carrying the tunnels ends.
+	Done() <-chan struct{}
+}
+
+type RunOptions struct {
+	Stdin io.Reader
+	// Env adds variables to the command's environment.
+	Env map[string]string
+	// Dir is the working directory; empty means the login directory.
+	Dir string
+}
+
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
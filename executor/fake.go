@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Fake is an in-memory Executor for tests. Commands are answered by Handler
+// and files live in Files.
+type Fake struct {
+	Handler  func(cmd string, opts RunOptions) (*Result, error)
+	Commands []string
+	Files    map[string][]byte
+
+	mu        sync.Mutex
+	connected bool
+}
+
+func NewFake(handler func(cmd string, opts RunOptions) (*Result, error)) *Fake {
+	return &Fake{Handler: handler, Files: map[string][]byte{}}
+}
+
+func (f *Fake) String() string {
+	return "fake"
+}
+
+func (f *Fake) Connect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = true
+	return nil
+}
+
+func (f *Fake) Run(ctx context.Context, cmd string, opts RunOptions) (*Result, error) {
+	f.mu.Lock()
+	if !f.connected {
+		f.mu.Unlock()
+		return nil, ErrNotConnected
+	}
+	f.Commands = append(f.Commands, cmd)
+	handler := f.Handler
+	f.mu.Unlock()
+
+	if handler == nil {
+		return &Result{}, nil
+	}
+	return handler(cmd, opts)
+}
+
+func (f *Fake) Upload(ctx context.Context, path string, data []byte, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	f.Files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+func (f *Fake) Download(ctx context.Context, path string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return nil, ErrNotConnected
+	}
+	data, ok := f.Files[path]
+	if !ok {
+		return nil, fmt.Errorf("download %s: no such file", path)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+	return nil
+}
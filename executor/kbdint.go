@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Prompter asks a human to answer keyboard-interactive questions the
+// configuration cannot answer. echos reports, per question, whether the
+// answer may be displayed.
+type Prompter func(ctx context.Context, host, instruction string, questions []string, echos []bool) ([]string, error)
+
+// KeyboardInteractive configures how keyboard-interactive prompts are
+// answered, in order: static responses, the password for password prompts,
+// a TOTP code for one-time-password prompts, and finally Prompt.
+type KeyboardInteractive struct {
+	// Responses maps a case-insensitive substring of a prompt to its answer.
+	Responses map[string]string
+	// TOTPSecret is the base32 secret of an RFC 6238 authenticator.
+	TOTPSecret string
+	Prompt     Prompter
+}
+
+func (k KeyboardInteractive) enabled() bool {
+	return len(k.Responses) > 0 || k.TOTPSecret != "" || k.Prompt != nil
+}
+
+// usesTOTP reports whether logging in with cfg, or to one of its jump hosts,
+// may answer with a TOTP code.
+func (cfg SSHConfig) usesTOTP() bool {
+	for c := &cfg; c != nil; c = c.Jump {
+		if c.KeyboardInteractive.TOTPSecret != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// onPrompt returns cfg with the prompters of it and its jump hosts calling
+// hook before they ask.
+func (cfg SSHConfig) onPrompt(hook func()) SSHConfig {
+	if prompt := cfg.KeyboardInteractive.Prompt; prompt != nil {
+		cfg.KeyboardInteractive.Prompt = func(ctx context.Context, host, instruction string, questions []string, echos []bool) ([]string, error) {
+			hook()
+			return prompt(ctx, host, instruction, questions, echos)
+		}
+	}
+	if cfg.Jump != nil {
+		jump := cfg.Jump.onPrompt(hook)
+		cfg.Jump = &jump
+	}
+	return cfg
+}
+
+// unattended returns cfg, and its jump hosts, without the TOTP secret and
+// the prompter, so that logging in uses no one-time code and asks no human.
+func (cfg SSHConfig) unattended() SSHConfig {
+	cfg.KeyboardInteractive.TOTPSecret = ""
+	cfg.KeyboardInteractive.Prompt = nil
+	if cfg.Jump != nil {
+		jump := cfg.Jump.unattended()
+		cfg.Jump = &jump
+	}
+	return cfg
+}
+
+var (
+	passwordPrompt = regexp.MustCompile(`(?i)pass(word|phrase)`)
+	otpPrompt      = regexp.MustCompile(`(?i)\b(code|otp|token|one[- ]time|verification|passcode|authenticator|2fa|mfa)\b`)
+)
+
+// challenge answers keyboard-interactive questions for cfg.
+func challenge(ctx context.Context, cfg SSHConfig) ssh.KeyboardInteractiveChallenge {
+	k := cfg.KeyboardInteractive
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		var ask []int
+		for i, q := range questions {
+			if answer, ok := k.staticResponse(q); ok {
+				answers[i] = answer
+				continue
+			}
+			if cfg.Password != "" && passwordPrompt.MatchString(q) && !otpPrompt.MatchString(q) {
+				answers[i] = cfg.Password
+				continue
+			}
+			if k.TOTPSecret != "" && otpPrompt.MatchString(q) {
+				code, err := TOTP(k.TOTPSecret, time.Now())
+				if err != nil {
+					return nil, err
+				}
+				answers[i] = code
+				continue
+			}
+			ask = append(ask, i)
+		}
+		if len(ask) == 0 {
+			return answers, nil
+		}
+		if k.Prompt == nil {
+			return nil, fmt.Errorf("no answer configured for keyboard-interactive prompt %q", strings.TrimSpace(questions[ask[0]]))
+		}
+		qs := make([]string, len(ask))
+		es := make([]bool, len(ask))
+		for j, i := range ask {
+			qs[j], es[j] = questions[i], echos[i]
+		}
+		if instruction == "" {
+			instruction = name
+		}
+		replies, err := k.Prompt(ctx, describe(cfg), instruction, qs, es)
+		if err != nil {
+			return nil, err
+		}
+		if len(replies) != len(ask) {
+			return nil, fmt.Errorf("got %d answers for %d keyboard-interactive prompts", len(replies), len(ask))
+		}
+		for j, i := range ask {
+			answers[i] = replies[j]
+		}
+		return answers, nil
+	}
+}
+
+// staticResponse returns the configured response whose key is the longest
+// substring of the prompt.
+func (k KeyboardInteractive) staticResponse(prompt string) (string, bool) {
+	keys := make([]string, 0, len(k.Responses))
+	for key := range k.Responses {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	lower := strings.ToLower(prompt)
+	for _, key := range keys {
+		if strings.Contains(lower, strings.ToLower(key)) {
+			return k.Responses[key], true
+		}
+	}
+	return "", false
+}
+
+// TOTP returns the 6-digit RFC 6238 code for a base32 secret at t, using
+// HMAC-SHA1 and 30-second steps like common authenticator apps.
+func TOTP(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-executor/internal/sshtest"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 secret "12345678901234567890".
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := TOTP(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Errorf("TOTP at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+	if got, _ := TOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("lower-case spaced secret: %q", got)
+	}
+	if _, err := TOTP("not base32!", time.Now()); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestKeyboardInteractive(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	srv := sshtest.Start(t, sshtest.Config{
+		Questions: []string{"Password: ", "Verification code: ", "Favourite colour? "},
+		CheckAnswers: func(answers []string) bool {
+			code, _ := TOTP(secret, time.Now())
+			return len(answers) == 3 && answers[0] == "pw" && answers[1] == code && answers[2] == "blue"
+		},
+	})
+	cfg := SSHConfig{Host: srv.Host, Port: srv.Port, User: "test", Password: "pw"}
+	cfg.KeyboardInteractive.TOTPSecret = secret
+
+	err := NewSSHExecutor(cfg).Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `no answer configured for keyboard-interactive prompt "Favourite colour?"`) {
+		t.Errorf("unanswerable prompt: %v", err)
+	}
+
+	cfg.KeyboardInteractive.Responses = map[string]string{"COLOUR": "blue"}
+	exec := NewSSHExecutor(cfg)
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatalf("static responses: %v", err)
+	}
+	exec.Close()
+
+	var asked []string
+	cfg.KeyboardInteractive.Responses = nil
+	cfg.KeyboardInteractive.Prompt = func(ctx context.Context, host, instruction string, questions []string, echos []bool) ([]string, error) {
+		asked = append(asked, questions...)
+		return []string{"blue"}, nil
+	}
+	exec = NewSSHExecutor(cfg)
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatalf("prompted: %v", err)
+	}
+	exec.Close()
+	if len(asked) != 1 || asked[0] != "Favourite colour? " {
+		t.Errorf("asked %q", asked)
+	}
+}
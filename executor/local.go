@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// LocalExecutor runs commands as subprocesses of the server through sh -c.
+type LocalExecutor struct {
+	Shell string
+
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+func NewLocalExecutor() *LocalExecutor {
+	return &LocalExecutor{Shell: "/bin/sh"}
+}
+
+func (l *LocalExecutor) String() string {
+	return "local"
+}
+
+func (l *LocalExecutor) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (l *LocalExecutor) Run(ctx context.Context, cmd string, opts RunOptions) (*Result, error) {
+	return l.run(ctx, exec.CommandContext(ctx, l.Shell, "-c", cmd), opts)
+}
+
+// RunArgv starts argv[0] directly, without a shell.
+func (l *LocalExecutor) RunArgv(ctx context.Context, argv []string, opts RunOptions) (*Result, error) {
+	return l.run(ctx, exec.CommandContext(ctx, argv[0], argv[1:]...), opts)
+}
+
+func (l *LocalExecutor) run(ctx context.Context, c *exec.Cmd, opts RunOptions) (*Result, error) {
+	if err := CheckEnv(opts.Env); err != nil {
+		return nil, err
+	}
+	c.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		c.Env = os.Environ()
+		for name, value := range opts.Env {
+			c.Env = append(c.Env, name+"="+value)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	c.Stdin = opts.Stdin
+
+	start := time.Now()
+	err := c.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result := &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		err = nil
+	}
+	return result, err
+}
+
+func (l *LocalExecutor) Upload(ctx context.Context, path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if mode.Perm() != 0 {
+		return os.Chmod(path, mode.Perm())
+	}
+	return nil
+}
+
+func (l *LocalExecutor) Download(ctx context.Context, path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// Dial connects to addr from the local machine.
+func (l *LocalExecutor) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+}
+
+func (l *LocalExecutor) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Done is closed by Close.
+func (l *LocalExecutor) Done() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	return l.done
+}
+
+func (l *LocalExecutor) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done != nil {
+		close(l.done)
+		l.done = nil
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultMaxConnections = 4
+	// defaultMaxSessions matches the MaxSessions default of OpenSSH.
+	defaultMaxSessions  = 10
+	defaultQueueTimeout = 30 * time.Second
+	defaultIdleTimeout  = 5 * time.Minute
+)
+
+// PoolConfig limits the connections and sessions an SSHExecutor uses to run
+// commands. Zero fields take the defaults.
+type PoolConfig struct {
+	// MaxConnections is the most connections opened to the host, the first
+	// one included (default 4). Hosts whose login needs a TOTP code or an
+	// answer from the user keep to one connection.
+	MaxConnections int
+	// MaxSessions is the most commands run at once over one connection
+	// (default 10). A lower limit is learned when the server refuses a
+	// session.
+	MaxSessions int
+	// QueueTimeout is how long a command waits for a free session when
+	// every connection is busy (default 30s).
+	QueueTimeout time.Duration
+	// IdleTimeout closes extra connections that ran no command for this
+	// long (default 5m). The first connection stays open.
+	IdleTimeout time.Duration
+}
+
+func (c PoolConfig) maxConnections() int {
+	if c.MaxConnections > 0 {
+		return c.MaxConnections
+	}
+	return defaultMaxConnections
+}
+
+func (c PoolConfig) maxSessions() int {
+	if c.MaxSessions > 0 {
+		return c.MaxSessions
+	}
+	return defaultMaxSessions
+}
+
+func (c PoolConfig) queueTimeout() time.Duration {
+	if c.QueueTimeout > 0 {
+		return c.QueueTimeout
+	}
+	return defaultQueueTimeout
+}
+
+func (c PoolConfig) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+// PoolStats describes the connections of a pool and what they did so far.
+type PoolStats struct {
+	Connections    []ConnStats `json:"connections"`
+	MaxConnections int         `json:"max_connections"`
+	// Waiting counts the commands queued for a free session.
+	Waiting int `json:"waiting"`
+	// Opened counts the extra connections opened.
+	Opened        int `json:"opened"`
+	IdleClosed    int `json:"idle_closed"`
+	Refused       int `json:"sessions_refused"`
+	QueueTimeouts int `json:"queue_timeouts"`
+}
+
+// ConnStats describes one connection of a pool.
+type ConnStats struct {
+	// Primary marks the first connection, which also carries tunnels.
+	Primary  bool `json:"primary"`
+	Sessions int  `json:"sessions"`
+	// Limit is the number of sessions the connection takes at once.
+	Limit int `json:"limit"`
+	// IdleMs is how long the connection has had no session.
+	IdleMs int64 `json:"idle_ms"`
+}
+
+// sessionPool opens sessions on the primary connection of an SSHExecutor
+// and, once the server refuses more there, on extra connections to the same
+// host. When no connection can be added, callers wait for a session to end.
+type sessionPool struct {
+	cfg  PoolConfig
+	dial func(ctx context.Context) (*ssh.Client, []*ssh.Client, error)
+	log  *slog.Logger
+
+	mu      sync.Mutex
+	conns   []*pooledConn
+	dialing int
+	waiting int
+	// freed is closed and replaced whenever a session or connection may
+	// have become available.
+	freed  chan struct{}
+	closed bool
+	stop   chan struct{}
+	stats  PoolStats
+}
+
+type pooledConn struct {
+	client    *ssh.Client
+	jumps     []*ssh.Client
+	primary   bool
+	sessions  int
+	limit     int
+	idleSince time.Time
+}
+
+func newSessionPool(cfg PoolConfig, primary *ssh.Client, dial func(ctx context.Context) (*ssh.Client, []*ssh.Client, error), log *slog.Logger) *sessionPool {
+	p := &sessionPool{
+		cfg:   cfg,
+		dial:  dial,
+		log:   log,
+		conns: []*pooledConn{{client: primary, primary: true, limit: cfg.maxSessions(), idleSince: time.Now()}},
+		freed: make(chan struct{}),
+		stop:  make(chan struct{}),
+	}
+	go p.closeIdle(cfg.idleTimeout())
+	return p
+}
+
+// session opens a session, waiting up to the queue timeout for room. The
+// returned func must be called once the session is closed.
+func (p *sessionPool) session(ctx context.Context) (*ssh.Session, func(), error) {
+	timeout := time.NewTimer(p.cfg.queueTimeout())
+	defer timeout.Stop()
+	for {
+		c, err := p.acquire(ctx, timeout.C)
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := c.client.NewSession()
+		if err == nil {
+			return session, func() { p.release(c) }, nil
+		}
+		retry := isProhibited(err) && p.lowerLimit(c)
+		p.release(c)
+		if !retry {
+			return nil, nil, err
+		}
+	}
+}
+
+// acquire reserves a session on a connection with room, opening another
+// connection if all are full. If that connection cannot be opened, it waits
+// for a session on the open ones instead.
+func (p *sessionPool) acquire(ctx context.Context, timeout <-chan time.Time) (*pooledConn, error) {
+	var dialErr error
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrNotConnected
+		}
+		for _, c := range p.conns {
+			if c.sessions < c.limit {
+				c.sessions++
+				p.mu.Unlock()
+				return c, nil
+			}
+		}
+		if dialErr == nil && len(p.conns)+p.dialing < p.cfg.maxConnections() {
+			p.dialing++
+			p.mu.Unlock()
+			c, err := p.open(ctx)
+			if err == nil || ctx.Err() != nil || errors.Is(err, ErrNotConnected) {
+				return c, err
+			}
+			p.log.Warn("opening another connection failed; waiting for a session", "error", err)
+			dialErr = err
+			continue
+		}
+		freed := p.freed
+		p.waiting++
+		p.mu.Unlock()
+
+		var err error
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = fmt.Errorf("no SSH session became free within %s; all %d connections are busy", p.cfg.queueTimeout(), p.cfg.maxConnections())
+			if dialErr != nil {
+				err = fmt.Errorf("no SSH session became free within %s; %w", p.cfg.queueTimeout(), dialErr)
+			}
+		}
+		p.mu.Lock()
+		p.waiting--
+		if err != nil && ctx.Err() == nil {
+			p.stats.QueueTimeouts++
+		}
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// open dials an extra connection with one session reserved on it.
+func (p *sessionPool) open(ctx context.Context) (*pooledConn, error) {
+	client, jumps, err := p.dial(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing--
+	if err != nil {
+		p.signalLocked()
+		return nil, fmt.Errorf("opening another connection: %w", err)
+	}
+	if p.closed {
+		client.Close()
+		closeClients(jumps)
+		return nil, ErrNotConnected
+	}
+	c := &pooledConn{client: client, jumps: jumps, sessions: 1, limit: p.cfg.maxSessions()}
+	p.conns = append(p.conns, c)
+	p.stats.Opened++
+	p.signalLocked()
+	p.log.Info("opened another connection", "connections", len(p.conns))
+	go func() {
+		client.Wait()
+		p.remove(c)
+	}()
+	return c, nil
+}
+
+// lowerLimit caps c at the sessions it has open besides the refused one. It
+// returns false if the server refused c's only session, so that waiting
+// would not help.
+func (p *sessionPool) lowerLimit(c *pooledConn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.sessions <= 1 {
+		return false
+	}
+	c.limit = c.sessions - 1
+	p.stats.Refused++
+	p.log.Debug("server refused a session", "sessions", c.limit)
+	return true
+}
+
+func (p *sessionPool) release(c *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.sessions--
+	if c.sessions == 0 {
+		c.idleSince = time.Now()
+	}
+	p.signalLocked()
+}
+
+// remove drops an extra connection that ended.
+func (p *sessionPool) remove(c *pooledConn) {
+	p.mu.Lock()
+	p.removeLocked(c)
+	p.mu.Unlock()
+	closeClients(c.jumps)
+}
+
+func (p *sessionPool) removeLocked(c *pooledConn) {
+	for i, other := range p.conns {
+		if other == c {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			p.signalLocked()
+			return
+		}
+	}
+}
+
+func (p *sessionPool) signalLocked() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// closeIdle closes extra connections idle for longer than timeout until the
+// pool is closed. Connections are checked every timeout/2, but at most once
+// a second.
+func (p *sessionPool) closeIdle(timeout time.Duration) {
+	ticker := time.NewTicker(max(timeout/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			var idle []*pooledConn
+			p.mu.Lock()
+			for _, c := range p.conns {
+				if !c.primary && c.sessions == 0 && now.Sub(c.idleSince) >= timeout {
+					idle = append(idle, c)
+				}
+			}
+			// Drop them before closing so that no session is opened on them.
+			for _, c := range idle {
+				p.removeLocked(c)
+			}
+			p.stats.IdleClosed += len(idle)
+			p.mu.Unlock()
+			for _, c := range idle {
+				p.log.Info("closing idle connection")
+				c.client.Close()
+			}
+		}
+	}
+}
+
+// close closes the extra connections and fails waiting callers. The primary
+// connection is left to its SSHExecutor.
+func (p *sessionPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	p.signalLocked()
+	var extra []*pooledConn
+	for _, c := range p.conns {
+		if !c.primary {
+			extra = append(extra, c)
+		}
+	}
+	p.mu.Unlock()
+	for _, c := range extra {
+		c.client.Close()
+	}
+}
+
+func (p *sessionPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.MaxConnections = p.cfg.maxConnections()
+	stats.Waiting = p.waiting
+	stats.Connections = make([]ConnStats, len(p.conns))
+	for i, c := range p.conns {
+		stats.Connections[i] = ConnStats{Primary: c.primary, Sessions: c.sessions, Limit: c.limit}
+		if c.sessions == 0 {
+			stats.Connections[i].IdleMs = time.Since(c.idleSince).Milliseconds()
+		}
+	}
+	return stats
+}
+
+// isProhibited reports whether the server refused to open a channel, as
+// OpenSSH does past MaxSessions.
+func isProhibited(err error) bool {
+	var open *ssh.OpenChannelError
+	return errors.As(err, &open) && open.Reason == ssh.Prohibited
+}
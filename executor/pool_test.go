@@ -0,0 +1,247 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"ssh-executor/internal/sshtest"
+)
+
+func TestSSHExecutorPool(t *testing.T) {
+	started := make(chan struct{}, 10)
+	unblock := make(chan struct{})
+	var once sync.Once
+	defer once.Do(func() { close(unblock) })
+	srv := sshtest.Start(t, sshtest.Config{
+		Password:    "pw",
+		MaxSessions: 2,
+		Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+			started <- struct{}{}
+			<-unblock
+			return sshtest.ExecResult{Stdout: req.Command}
+		},
+	})
+	exec := NewSSHExecutor(SSHConfig{
+		Host: srv.Host, Port: srv.Port, User: "test", Password: "pw",
+		Pool: PoolConfig{MaxConnections: 2, QueueTimeout: 200 * time.Millisecond, IdleTimeout: 100 * time.Millisecond},
+	})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+
+	// Four commands fill two connections of two sessions each.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := exec.Run(context.Background(), "wait", RunOptions{})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-started:
+		case err := <-errs:
+			t.Fatalf("run: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d commands started", i)
+		}
+	}
+	if n := srv.Connections(); n != 2 {
+		t.Errorf("server saw %d connections, want 2", n)
+	}
+
+	// A fifth has to wait and gives up after the queue timeout.
+	_, err := exec.Run(context.Background(), "queued", RunOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no SSH session became free") {
+		t.Errorf("queued err = %v", err)
+	}
+
+	stats := exec.PoolStats()
+	if len(stats.Connections) != 2 || stats.Opened != 1 || stats.Refused == 0 || stats.QueueTimeouts != 1 {
+		t.Errorf("busy stats = %+v", stats)
+	}
+	for _, c := range stats.Connections {
+		if c.Sessions != 2 || c.Limit != 2 {
+			t.Errorf("connection = %+v, want 2 of 2 sessions", c)
+		}
+	}
+
+	once.Do(func() { close(unblock) })
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}
+
+	// The extra connection is closed once idle; the first one stays.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats = exec.PoolStats()
+		if len(stats.Connections) == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(stats.Connections) != 1 || !stats.Connections[0].Primary || stats.IdleClosed != 1 {
+		t.Fatalf("idle stats = %+v", stats)
+	}
+	if res, err := exec.Run(context.Background(), "again", RunOptions{}); err != nil || res.Stdout != "again" {
+		t.Errorf("run after idle close = %+v, %v", res, err)
+	}
+}
+
+func TestSSHExecutorPoolDialFailure(t *testing.T) {
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	srv := sshtest.Start(t, sshtest.Config{
+		Password:    "pw",
+		MaxSessions: 1,
+		Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+			if req.Command == "hold" {
+				started <- struct{}{}
+				<-unblock
+			}
+			return sshtest.ExecResult{Stdout: req.Command}
+		},
+	})
+	exec := NewSSHExecutor(SSHConfig{
+		Host: srv.Host, Port: srv.Port, User: "test", Password: "pw",
+		Pool: PoolConfig{MaxConnections: 2, QueueTimeout: 300 * time.Millisecond},
+	})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+	exec.pool.dial = func(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+		return nil, nil, errors.New("connection refused")
+	}
+
+	held := make(chan error, 1)
+	go func() {
+		_, err := exec.Run(context.Background(), "hold", RunOptions{})
+		held <- err
+	}()
+	<-started
+
+	// With no other connection to open, commands wait for the busy one.
+	_, err := exec.Run(context.Background(), "timed out", RunOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no SSH session became free within 300ms") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("queued err = %v", err)
+	}
+	waited := make(chan error, 1)
+	go func() {
+		res, err := exec.Run(context.Background(), "waited", RunOptions{})
+		if err == nil && res.Stdout != "waited" {
+			err = errors.New("stdout = " + res.Stdout)
+		}
+		waited <- err
+	}()
+	for exec.PoolStats().Waiting == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(unblock)
+	if err := <-waited; err != nil {
+		t.Errorf("waiting run: %v", err)
+	}
+	if err := <-held; err != nil {
+		t.Errorf("held run: %v", err)
+	}
+	if stats := exec.PoolStats(); stats.Opened != 0 || len(stats.Connections) != 1 || stats.QueueTimeouts != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestSSHExecutorPoolShortIdleTimeout(t *testing.T) {
+	srv := sshtest.Start(t, sshtest.Config{Password: "pw"})
+	exec := NewSSHExecutor(SSHConfig{
+		Host: srv.Host, Port: srv.Port, User: "test", Password: "pw",
+		Pool: PoolConfig{IdleTimeout: time.Nanosecond},
+	})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+	if _, err := exec.Run(context.Background(), "true", RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSSHExecutorPoolInteractiveLogin(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	otp := KeyboardInteractive{TOTPSecret: secret}
+	var prompts int
+	human := KeyboardInteractive{Prompt: func(ctx context.Context, host, instruction string, questions []string, echos []bool) ([]string, error) {
+		prompts++
+		code, err := TOTP(secret, time.Now())
+		return []string{code}, err
+	}}
+	for name, k := range map[string]KeyboardInteractive{"totp": otp, "prompt": human} {
+		t.Run(name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			unblock := make(chan struct{})
+			var once sync.Once
+			defer once.Do(func() { close(unblock) })
+			srv := sshtest.Start(t, sshtest.Config{
+				Questions: []string{"Verification code: "},
+				CheckAnswers: func(answers []string) bool {
+					code, _ := TOTP(secret, time.Now())
+					return len(answers) == 1 && answers[0] == code
+				},
+				MaxSessions: 1,
+				Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+					if req.Command == "hold" {
+						started <- struct{}{}
+						<-unblock
+					}
+					return sshtest.ExecResult{Stdout: req.Command}
+				},
+			})
+			exec := NewSSHExecutor(SSHConfig{
+				Host: srv.Host, Port: srv.Port, User: "test", KeyboardInteractive: k,
+				Pool: PoolConfig{MaxConnections: 4, QueueTimeout: 200 * time.Millisecond},
+			})
+			if err := exec.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer exec.Close()
+
+			held := make(chan error, 1)
+			go func() {
+				_, err := exec.Run(context.Background(), "hold", RunOptions{})
+				held <- err
+			}()
+			<-started
+
+			// The busy connection is not joined by a second login.
+			_, err := exec.Run(context.Background(), "queued", RunOptions{})
+			if err == nil || !strings.Contains(err.Error(), "all 1 connections are busy") {
+				t.Errorf("queued err = %v", err)
+			}
+			if n := srv.Connections(); n != 1 {
+				t.Errorf("server saw %d connections, want 1", n)
+			}
+			once.Do(func() { close(unblock) })
+			if err := <-held; err != nil {
+				t.Errorf("held run: %v", err)
+			}
+			if stats := exec.PoolStats(); stats.MaxConnections != 1 || stats.Opened != 0 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+	if prompts != 1 {
+		t.Errorf("user was asked %d times, want once", prompts)
+	}
+}
@@ -0,0 +1,466 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"ssh-executor/shell"
+)
+
+type SSHConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	KeyPath  string
+	// CertPath is the OpenSSH user certificate for KeyPath. When empty,
+	// KeyPath + "-cert.pub" is used if it exists.
+	CertPath string
+	// HostCAPath names a file of CA keys; when set, hosts must present a
+	// certificate signed by one of them.
+	HostCAPath string
+	// KeyboardInteractive answers keyboard-interactive prompts, such as a
+	// one-time password after the password.
+	KeyboardInteractive KeyboardInteractive
+	// Jump is the host to tunnel the connection through, if any.
+	Jump *SSHConfig
+	// Logger receives authentication attempts and connection events; nil
+	// discards them.
+	Logger *slog.Logger
+	// Pool limits the connections opened to run commands concurrently.
+	Pool PoolConfig
+}
+
+func (c SSHConfig) logger() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+	return c.Logger
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// SSHConfigFromEnv reads SSH_HOST, SSH_USER, SSH_PASSWORD,
+// SSH_PRIVATE_KEY_PATH, SSH_CERTIFICATE_PATH, SSH_HOST_CA_KEYS and SSH_PORT.
+func SSHConfigFromEnv() SSHConfig {
+	port, _ := strconv.Atoi(os.Getenv("SSH_PORT"))
+	if port == 0 {
+		port = 22
+	}
+	return SSHConfig{
+		Host:     os.Getenv("SSH_HOST"),
+		Port:     port,
+		User:     os.Getenv("SSH_USER"),
+		Password: os.Getenv("SSH_PASSWORD"),
+		KeyPath:  os.Getenv("SSH_PRIVATE_KEY_PATH"),
+
+		CertPath:   os.Getenv("SSH_CERTIFICATE_PATH"),
+		HostCAPath: os.Getenv("SSH_HOST_CA_KEYS"),
+	}
+}
+
+// WithAddress returns a copy of c pointed at spec, which has the form
+// [user@]host[:port]. Parts missing from spec keep their values from c.
+func (c SSHConfig) WithAddress(spec string) (SSHConfig, error) {
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		c.User = spec[:i]
+		spec = spec[i+1:]
+	}
+	host, portStr, err := net.SplitHostPort(spec)
+	if err != nil {
+		host, portStr = strings.Trim(spec, "[]"), ""
+	}
+	if host == "" {
+		return c, fmt.Errorf("invalid host address %q", spec)
+	}
+	c.Host = host
+	if portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			return c, fmt.Errorf("invalid port in host address %q", spec)
+		}
+		c.Port = port
+	}
+	return c, nil
+}
+
+type SSHExecutor struct {
+	Config SSHConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	jumps  []*ssh.Client
+	done   chan struct{}
+	pool   *sessionPool
+}
+
+func NewSSHExecutor(cfg SSHConfig) *SSHExecutor {
+	return &SSHExecutor{Config: cfg}
+}
+
+// String describes the connection target as user@host:port, followed by the
+// jump hosts in use.
+func (s *SSHExecutor) String() string {
+	return describe(s.Config)
+}
+
+func describe(cfg SSHConfig) string {
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	desc := fmt.Sprintf("%s@%s", cfg.User, net.JoinHostPort(cfg.Host, strconv.Itoa(port)))
+	if cfg.Jump != nil {
+		desc += " via " + describe(*cfg.Jump)
+	}
+	return desc
+}
+
+func (s *SSHExecutor) Connect(ctx context.Context) error {
+	var prompted atomic.Bool
+	client, jumps, err := dial(ctx, s.Config.onPrompt(func() { prompted.Store(true) }))
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		err := client.Wait()
+		s.mu.Lock()
+		lost := s.client == client
+		s.mu.Unlock()
+		if lost {
+			s.Config.logger().Warn("connection lost", "logger", "ssh", "target", describe(s.Config), "error", err)
+		}
+		close(done)
+	}()
+
+	cfg := s.Config
+	log := cfg.logger().With("logger", "ssh", "target", describe(cfg))
+	// Another login would need another one-time code or ask the user again,
+	// so such hosts keep to one connection. Extra connections never do
+	// either.
+	poolCfg := cfg.Pool
+	if prompted.Load() || cfg.usesTOTP() {
+		poolCfg.MaxConnections = 1
+	}
+	pool := newSessionPool(poolCfg, client, func(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+		return dial(ctx, cfg.unattended())
+	}, log)
+
+	s.mu.Lock()
+	s.closeLocked()
+	s.client = client
+	s.jumps = jumps
+	s.done = done
+	s.pool = pool
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SSHExecutor) sessions() (*sessionPool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool == nil {
+		return nil, ErrNotConnected
+	}
+	return s.pool, nil
+}
+
+// PoolStats reports the connections used to run commands. It is empty
+// while not connected.
+func (s *SSHExecutor) PoolStats() PoolStats {
+	pool, err := s.sessions()
+	if err != nil {
+		return PoolStats{MaxConnections: s.Config.Pool.maxConnections()}
+	}
+	return pool.Stats()
+}
+
+func (s *SSHExecutor) connection() (*ssh.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil, ErrNotConnected
+	}
+	return s.client, nil
+}
+
+// Dial connects to addr from the remote host over a direct-tcpip channel.
+func (s *SSHExecutor) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, "tcp", addr)
+}
+
+// Listen asks the remote host to listen on addr and forward connections
+// back over SSH.
+func (s *SSHExecutor) Listen(addr string) (net.Listener, error) {
+	client, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	return client.Listen("tcp", addr)
+}
+
+// Done is closed when the current connection ends, whether through Close or
+// because the network connection dropped.
+func (s *SSHExecutor) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return s.done
+}
+
+func clientConfig(ctx context.Context, cfg SSHConfig) (*ssh.ClientConfig, error) {
+	if cfg.Host == "" || cfg.User == "" {
+		return nil, fmt.Errorf("SSH_HOST and SSH_USER required")
+	}
+
+	config := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	log := cfg.logger().With("logger", "ssh", "target", describe(cfg))
+
+	if cfg.Password != "" {
+		config.Auth = append(config.Auth, ssh.PasswordCallback(func() (string, error) {
+			log.Info("trying password authentication")
+			return cfg.Password, nil
+		}))
+	}
+
+	if cfg.KeyPath != "" {
+		key, err := os.ReadFile(expandHome(cfg.KeyPath))
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		certSigner, err := userCertSigner(signer, expandHome(cfg.KeyPath), cfg.CertPath, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		signers := []ssh.Signer{signer}
+		if certSigner != nil {
+			signers = []ssh.Signer{certSigner, signer}
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			log.Info("trying public key authentication", "key", cfg.KeyPath, "certificate", certSigner != nil)
+			return signers, nil
+		}))
+	}
+
+	if cfg.Password != "" || cfg.KeyboardInteractive.enabled() {
+		answer := challenge(ctx, cfg)
+		config.Auth = append(config.Auth, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if len(questions) > 0 {
+				log.Info("answering keyboard-interactive prompts", "prompts", len(questions))
+			}
+			return answer(name, instruction, questions, echos)
+		}))
+	}
+
+	if cfg.HostCAPath != "" {
+		cas, err := loadHostAuthorities(cfg.HostCAPath)
+		if err != nil {
+			return nil, err
+		}
+		config.HostKeyCallback = hostCertCallback(cas)
+	}
+	return config, nil
+}
+
+// dial connects to cfg, hopping through cfg.Jump when set. The returned
+// jump clients must be closed after the client.
+func dial(ctx context.Context, cfg SSHConfig) (*ssh.Client, []*ssh.Client, error) {
+	config, err := clientConfig(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+
+	var conn net.Conn
+	var jumps []*ssh.Client
+	if cfg.Jump != nil {
+		jump, chain, err := dial(ctx, *cfg.Jump)
+		if err != nil {
+			return nil, nil, fmt.Errorf("jump host %s: %w", cfg.Jump.Host, err)
+		}
+		jumps = append(chain, jump)
+		conn, err = jump.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			closeClients(jumps)
+			return nil, nil, fmt.Errorf("dial %s via %s: %w", addr, cfg.Jump.Host, err)
+		}
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The handshake has no timeout of its own, so a server that accepts the
+	// connection and never answers is cut off once ctx ends.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		err = fmt.Errorf("ssh handshake with %s: %w", addr, ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		closeClients(jumps)
+		return nil, nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), jumps, nil
+}
+
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// Run runs cmd in a new session. When the server allows no more sessions on
+// the open connections, another connection is opened, up to
+// Config.Pool.MaxConnections; past that, Run waits for a session to end.
+func (s *SSHExecutor) Run(ctx context.Context, cmd string, opts RunOptions) (*Result, error) {
+	pool, err := s.sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckEnv(opts.Env); err != nil {
+		return nil, err
+	}
+	session, release, err := pool.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer session.Close()
+
+	// Servers only accept the variables allowed by their AcceptEnv setting;
+	// export the rest in the command itself.
+	rejected := map[string]string{}
+	for name, value := range opts.Env {
+		if err := session.Setenv(name, value); err != nil {
+			rejected[name] = value
+		}
+	}
+	cmd = ShellPrefix(rejected, opts.Dir) + cmd
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	session.Stdin = opts.Stdin
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- session.Run(cmd) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return nil, ctx.Err()
+	}
+
+	result := &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+		err = nil
+	}
+	return result, err
+}
+
+func (s *SSHExecutor) Upload(ctx context.Context, path string, data []byte, mode os.FileMode) error {
+	cmd := "cat > " + shell.Quote(path)
+	if mode.Perm() != 0 {
+		cmd += fmt.Sprintf(" && chmod %o %s", mode.Perm(), shell.Quote(path))
+	}
+	res, err := s.Run(ctx, cmd, RunOptions{Stdin: bytes.NewReader(data)})
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("upload %s: %s", path, bytes.TrimSpace([]byte(res.Stderr)))
+	}
+	return nil
+}
+
+func (s *SSHExecutor) Download(ctx context.Context, path string) ([]byte, error) {
+	res, err := s.Run(ctx, "cat "+shell.Quote(path), RunOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("download %s: %s", path, bytes.TrimSpace([]byte(res.Stderr)))
+	}
+	return []byte(res.Stdout), nil
+}
+
+func (s *SSHExecutor) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+func (s *SSHExecutor) closeLocked() error {
+	if s.client == nil {
+		return nil
+	}
+	s.pool.close()
+	err := s.client.Close()
+	closeClients(s.jumps)
+	s.client = nil
+	s.jumps = nil
+	s.done = nil
+	s.pool = nil
+	return err
+}
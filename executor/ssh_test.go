@@ -0,0 +1,208 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-executor/internal/sshtest"
+)
+
+func connectTo(t *testing.T, srv *sshtest.Server, password string) *SSHExecutor {
+	t.Helper()
+	exec := NewSSHExecutor(SSHConfig{Host: srv.Host, Port: srv.Port, User: "test", Password: password})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { exec.Close() })
+	return exec
+}
+
+func TestSSHExecutorRun(t *testing.T) {
+	srv := sshtest.Start(t, sshtest.Config{
+		Password: "pw",
+		Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+			return sshtest.ExecResult{Stdout: "out:" + req.Command, Stderr: "err", ExitCode: 7}
+		},
+	})
+	exec := connectTo(t, srv, "pw")
+
+	res, err := exec.Run(context.Background(), "do-thing", RunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "out:do-thing" || res.Stderr != "err" || res.ExitCode != 7 {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestSSHExecutorRunCancelled(t *testing.T) {
+	srv := sshtest.Start(t, sshtest.Config{
+		Password: "pw",
+		Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+			return sshtest.ExecResult{Hang: true}
+		},
+	})
+	exec := connectTo(t, srv, "pw")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := exec.Run(ctx, "sleep forever", RunOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestSSHExecutorUploadDownload(t *testing.T) {
+	srv := sshtest.Start(t, sshtest.Config{Password: "pw"})
+	exec := connectTo(t, srv, "pw")
+	path := t.TempDir() + "/file with spaces"
+
+	if err := exec.Upload(context.Background(), path, []byte("payload\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := exec.Download(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "payload\n" {
+		t.Errorf("downloaded %q", data)
+	}
+	if _, err := exec.Download(context.Background(), path+".missing"); err == nil {
+		t.Error("download of missing file succeeded")
+	}
+}
+
+func TestSSHExecutorNotConnected(t *testing.T) {
+	exec := NewSSHExecutor(SSHConfig{Host: "127.0.0.1", User: "test"})
+	if _, err := exec.Run(context.Background(), "true", RunOptions{}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("err = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSSHExecutorJumpHost(t *testing.T) {
+	bastion := sshtest.Start(t, sshtest.Config{User: "jumper", Password: "jump"})
+	target := sshtest.Start(t, sshtest.Config{
+		Password: "pw",
+		Exec: func(req sshtest.ExecRequest) sshtest.ExecResult {
+			return sshtest.ExecResult{Stdout: "target"}
+		},
+	})
+
+	exec := NewSSHExecutor(SSHConfig{
+		Host: target.Host, Port: target.Port, User: "test", Password: "pw",
+		Jump: &SSHConfig{Host: bastion.Host, Port: bastion.Port, User: "jumper", Password: "jump"},
+	})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+
+	res, err := exec.Run(context.Background(), "hostname", RunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "target" {
+		t.Errorf("stdout = %q", res.Stdout)
+	}
+	if len(bastion.Commands()) != 0 {
+		t.Errorf("command ran on the jump host: %q", bastion.Commands())
+	}
+}
+
+func TestSSHExecutorSilentServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Accept connections and never answer.
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	bastion := sshtest.Start(t, sshtest.Config{User: "jumper", Password: "jump"})
+
+	for name, cfg := range map[string]SSHConfig{
+		"direct": {Host: "127.0.0.1", Port: addr.Port, User: "test", Password: "pw"},
+		"jump": {Host: "127.0.0.1", Port: addr.Port, User: "test", Password: "pw",
+			Jump: &SSHConfig{Host: bastion.Host, Port: bastion.Port, User: "jumper", Password: "jump"}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		err := NewSSHExecutor(cfg).Connect(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "handshake") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: connect took %s", name, d)
+		}
+	}
+}
+
+func TestSSHConfigWithAddress(t *testing.T) {
+	base := SSHConfig{Host: "default", Port: 22, User: "deploy"}
+	for spec, want := range map[string]SSHConfig{
+		"web1":           {Host: "web1", Port: 22, User: "deploy"},
+		"root@web1:2222": {Host: "web1", Port: 2222, User: "root"},
+		"[::1]:2200":     {Host: "::1", Port: 2200, User: "deploy"},
+		"admin@10.0.0.1": {Host: "10.0.0.1", Port: 22, User: "admin"},
+	} {
+		got, err := base.WithAddress(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if got.Host != want.Host || got.Port != want.Port || got.User != want.User {
+			t.Errorf("%s = %+v, want %+v", spec, got, want)
+		}
+	}
+	if _, err := base.WithAddress("web1:http"); err == nil {
+		t.Error("non-numeric port accepted")
+	}
+}
+
+func TestSSHExecutorEnvAndDir(t *testing.T) {
+	srv := sshtest.Start(t, sshtest.Config{Password: "pw", AcceptEnv: []string{"LANG", "LC_*"}})
+	exec := connectTo(t, srv, "pw")
+	dir := t.TempDir() + "/it's here"
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := "it's \"$HOME\" `x`\nline 2"
+	res, err := exec.Run(context.Background(), `printf '%s|%s|%s|%s' "$LANG" "$LC_ALL" "$MSG" "$(pwd)"`, RunOptions{
+		Env: map[string]string{"LANG": "C.UTF-8", "LC_ALL": "C", "MSG": msg},
+		Dir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "C.UTF-8|C|" + msg + "|" + dir; res.Stdout != want {
+		t.Errorf("stdout = %q, want %q", res.Stdout, want)
+	}
+	cmds := srv.Commands()
+	last := cmds[len(cmds)-1]
+	if !strings.Contains(last, "export MSG=") || strings.Contains(last, "LANG=") {
+		t.Errorf("command = %q; only rejected variables should be exported", last)
+	}
+
+	res, err = exec.Run(context.Background(), "echo never", RunOptions{Dir: dir + "/missing"})
+	if err != nil || res.ExitCode == 0 || strings.Contains(res.Stdout, "never") {
+		t.Errorf("missing dir: %+v, %v", res, err)
+	}
+	if _, err := exec.Run(context.Background(), "true", RunOptions{Env: map[string]string{"BAD-NAME": "x"}}); err == nil {
+		t.Error("invalid variable name accepted")
+	}
+}
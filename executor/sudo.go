@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"ssh-executor/shell"
+)
+
+// Sudo runs commands through sudo. The password, if any, is written to
+// sudo's standard input; it never appears on the command line and is
+// scrubbed from everything Run returns.
+type Sudo struct {
+	// User is the account to run as; empty means root.
+	User     string
+	Password string
+}
+
+// Redacted replaces the sudo password in command output.
+const Redacted = "[REDACTED]"
+
+// Command returns cmd wrapped in sudo. With a password sudo reads it from
+// stdin (-S) without printing a prompt; the command itself gets /dev/null as
+// stdin so it can never read the password. Without a password sudo runs
+// non-interactively (-n) and fails instead of waiting for one.
+func (s Sudo) Command(cmd string) string {
+	args := []string{"sudo"}
+	inner := cmd
+	if s.Password != "" {
+		args = append(args, "-S", "-p", "''")
+		inner = "exec </dev/null\n" + cmd
+	} else {
+		args = append(args, "-n")
+	}
+	if s.User != "" {
+		args = append(args, "-u", shell.Quote(s.User))
+	}
+	args = append(args, "--", "sh", "-c", shell.Quote(inner))
+	return strings.Join(args, " ")
+}
+
+// Run runs cmd on e as s.User. Since sudo resets the environment, opts.Env
+// and opts.Dir are applied inside the sudo shell; opts.Stdin is ignored.
+func (s Sudo) Run(ctx context.Context, e Executor, cmd string, opts RunOptions) (*Result, error) {
+	if err := CheckEnv(opts.Env); err != nil {
+		return nil, err
+	}
+	var stdin io.Reader
+	if s.Password != "" {
+		stdin = strings.NewReader(s.Password + "\n")
+	}
+	res, err := e.Run(ctx, s.Command(ShellPrefix(opts.Env, opts.Dir)+cmd), RunOptions{Stdin: stdin})
+	if err != nil {
+		if msg := s.Scrub(err.Error()); msg != err.Error() {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	res.Stdout = s.Scrub(res.Stdout)
+	res.Stderr = s.Scrub(res.Stderr)
+	return res, nil
+}
+
+// Scrub replaces every occurrence of the password in text.
+func (s Sudo) Scrub(text string) string {
+	if s.Password == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, s.Password, Redacted)
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSudo accepts the options Sudo uses, checks the password read with -S
+// and runs the command as the current user.
+const fakeSudo = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case $1 in
+	-S) read -r pw; [ "$pw" = hunter2 ] || { echo "sudo: wrong password" >&2; exit 1; } ;;
+	-n) echo "non-interactive" >&2 ;;
+	-p|-u) shift ;;
+	--) shift; break ;;
+	esac
+	shift
+done
+exec "$@"
+`
+
+func TestSudoRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	local := NewLocalExecutor()
+	ctx := context.Background()
+
+	sudo := Sudo{User: "postgres", Password: "hunter2"}
+	if cmd := sudo.Command("id"); strings.Contains(cmd, "hunter2") || !strings.Contains(cmd, "-u postgres") {
+		t.Errorf("command = %q", cmd)
+	}
+	res, err := sudo.Run(ctx, local, "cat; echo leaked hunter2 >&2; echo done", RunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 || res.Stdout != "done\n" || res.Stderr != "leaked [REDACTED]\n" {
+		t.Errorf("result = %+v", res)
+	}
+
+	res, err = Sudo{Password: "wrong"}.Run(ctx, local, "echo ran", RunOptions{})
+	if err != nil || res.ExitCode != 1 || strings.Contains(res.Stdout, "ran") {
+		t.Errorf("wrong password: %+v, %v", res, err)
+	}
+
+	res, err = Sudo{}.Run(ctx, local, "echo ran", RunOptions{})
+	if err != nil || res.Stdout != "ran\n" || !strings.Contains(res.Stderr, "non-interactive") {
+		t.Errorf("no password: %+v, %v", res, err)
+	}
+}
+
+func TestSudoRunEnvAndDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	res, err := Sudo{Password: "hunter2"}.Run(context.Background(), NewLocalExecutor(), `echo "$GREETING from $(pwd)"`,
+		RunOptions{Env: map[string]string{"GREETING": "it's me"}, Dir: dir})
+	if err != nil || res.Stdout != "it's me from "+dir+"\n" {
+		t.Errorf("result = %+v, %v", res, err)
+	}
+}
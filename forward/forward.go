@@ -0,0 +1,222 @@
+// Package forward relays TCP connections through an executor's tunnels:
+// local and remote port forwards and a SOCKS5 proxy.
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ssh-executor/executor"
+)
+
+type Kind string
+
+const (
+	// Local listens on this machine and connects to the target from the
+	// remote host.
+	Local Kind = "local"
+	// Remote listens on the remote host and connects to the target from
+	// this machine.
+	Remote Kind = "remote"
+	// Dynamic is a local SOCKS5 proxy connecting from the remote host.
+	Dynamic Kind = "dynamic"
+)
+
+// DefaultListen binds a free port on the loopback interface.
+const DefaultListen = "127.0.0.1:0"
+
+// Forward is a running port forward. It stops when Close is called or when
+// the connection carrying it ends.
+type Forward struct {
+	Kind Kind
+	// Listen is the bound address: on this machine for local and dynamic
+	// forwards, on the remote host for remote forwards.
+	Listen  string
+	Target  string
+	Started time.Time
+
+	tun      executor.Tunneler
+	listener net.Listener
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	active atomic.Int64
+	total  atomic.Int64
+}
+
+// Start starts a forward of the given kind over tun. An empty listen address
+// means DefaultListen. target is required for local and remote forwards.
+func Start(tun executor.Tunneler, kind Kind, listen, target string) (*Forward, error) {
+	if listen == "" {
+		listen = DefaultListen
+	}
+	var l net.Listener
+	var err error
+	switch kind {
+	case Local, Dynamic:
+		l, err = net.Listen("tcp", listen)
+	case Remote:
+		l, err = tun.Listen(listen)
+	default:
+		return nil, fmt.Errorf("unknown forward type %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind != Dynamic {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("invalid target %q: want host:port", target)
+		}
+	}
+
+	f := &Forward{
+		Kind:     kind,
+		Listen:   l.Addr().String(),
+		Target:   target,
+		Started:  time.Now(),
+		tun:      tun,
+		listener: l,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		conns:    map[net.Conn]struct{}{},
+	}
+	go f.watch()
+	go f.serve()
+	return f, nil
+}
+
+// Close stops the forward and closes its connections.
+func (f *Forward) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	<-f.done
+	return nil
+}
+
+// Done is closed once the forward has stopped.
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Connections returns the number of open and of all relayed connections.
+func (f *Forward) Connections() (active, total int64) {
+	return f.active.Load(), f.total.Load()
+}
+
+func (f *Forward) watch() {
+	select {
+	case <-f.stop:
+	case <-f.tun.Done():
+	}
+	f.listener.Close()
+	f.mu.Lock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.mu.Unlock()
+	close(f.done)
+}
+
+func (f *Forward) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			// The listener fails when the forward is closed or when the
+			// remote side drops it; stop in both cases.
+			f.stopOnce.Do(func() { close(f.stop) })
+			return
+		}
+		if !f.track(conn) {
+			conn.Close()
+			return
+		}
+		f.total.Add(1)
+		f.active.Add(1)
+		go func() {
+			defer f.active.Add(-1)
+			defer f.untrack(conn)
+			f.handle(conn)
+		}()
+	}
+}
+
+func (f *Forward) track(c net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.stop:
+		return false
+	default:
+	}
+	f.conns[c] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(c net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, c)
+	f.mu.Unlock()
+	c.Close()
+}
+
+func (f *Forward) handle(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	target := f.Target
+	if f.Kind == Dynamic {
+		var err error
+		if target, err = socksHandshake(conn); err != nil {
+			return
+		}
+	}
+
+	var peer net.Conn
+	var err error
+	if f.Kind == Remote {
+		peer, err = (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	} else {
+		peer, err = f.tun.Dial(ctx, target)
+	}
+	if f.Kind == Dynamic {
+		socksReply(conn, err)
+	}
+	if err != nil {
+		return
+	}
+	if !f.track(peer) {
+		peer.Close()
+		return
+	}
+	defer f.untrack(peer)
+	relay(conn, peer)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// relay copies data both ways until both directions are done.
+func relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
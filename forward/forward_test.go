@@ -0,0 +1,138 @@
+package forward
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/internal/sshtest"
+)
+
+// echoServer answers every line with "echo: <line>".
+func echoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				sc := bufio.NewScanner(c)
+				for sc.Scan() {
+					io.WriteString(c, "echo: "+sc.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func connect(t *testing.T) *executor.SSHExecutor {
+	t.Helper()
+	srv := sshtest.Start(t, sshtest.Config{Password: "pw"})
+	exec := executor.NewSSHExecutor(executor.SSHConfig{Host: srv.Host, Port: srv.Port, User: "test", Password: "pw"})
+	if err := exec.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { exec.Close() })
+	return exec
+}
+
+func roundTrip(t *testing.T, c net.Conn, line string) {
+	t.Helper()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(c, line+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || got != "echo: "+line+"\n" {
+		t.Fatalf("read %q, %v", got, err)
+	}
+}
+
+func TestLocalAndRemoteForwards(t *testing.T) {
+	target := echoServer(t)
+	exec := connect(t)
+
+	for _, kind := range []Kind{Local, Remote} {
+		f, err := Start(exec, kind, "", target)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if !strings.HasPrefix(f.Listen, "127.0.0.1:") || strings.HasSuffix(f.Listen, ":0") {
+			t.Errorf("%s: listen address %q", kind, f.Listen)
+		}
+		c, err := net.Dial("tcp", f.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip(t, c, "hello "+string(kind))
+		c.Close()
+		if _, total := f.Connections(); total != 1 {
+			t.Errorf("%s: total connections = %d", kind, total)
+		}
+		f.Close()
+		if _, err := net.Dial("tcp", f.Listen); err == nil {
+			t.Errorf("%s: still listening after Close", kind)
+		}
+	}
+}
+
+func TestDynamicForward(t *testing.T) {
+	target := echoServer(t)
+	exec := connect(t)
+	f, err := Start(exec, Dynamic, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c, err := net.Dial("tcp", f.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, portStr, _ := net.SplitHostPort(target)
+	port, _ := net.LookupPort("tcp", portStr)
+	// Greeting offering no authentication, then CONNECT by domain name.
+	req := []byte{5, 1, 0, 5, 1, 0, 3, byte(len("localhost"))}
+	req = append(req, "localhost"...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	c.Write(req)
+	reply := make([]byte, 12)
+	if _, err := io.ReadFull(c, reply); err != nil || reply[0] != 5 || reply[1] != 0 || reply[3] != 0 {
+		t.Fatalf("SOCKS reply %v, %v", reply, err)
+	}
+	roundTrip(t, c, "through socks")
+}
+
+func TestForwardEndsWithConnection(t *testing.T) {
+	exec := connect(t)
+	f, err := Start(exec, Local, "", echoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.Close()
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward still running after its connection closed")
+	}
+	if _, err := net.Dial("tcp", f.Listen); err == nil {
+		t.Error("still listening after the connection closed")
+	}
+}
@@ -3,5 +3,9 @@ module ssh-executor
 go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.15.0 // indirect
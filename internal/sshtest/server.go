@@ -0,0 +1,550 @@
+// Package sshtest runs an in-process SSH server on a loopback port for tests.
+package sshtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecRequest describes an exec request received by the server.
+type ExecRequest struct {
+	Command string
+	Stdin   io.Reader
+	Env     map[string]string
+}
+
+// ExecResult is the reply to an exec request. When Hang is set the server
+// never answers and keeps the channel open until the client closes it.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Hang     bool
+}
+
+type Config struct {
+	User       string
+	Password   string
+	PublicKeys []ssh.PublicKey
+	// UserCA, when set, accepts user certificates it signed for User.
+	UserCA ssh.PublicKey
+	// HostCA, when set, signs the host key into a host certificate that the
+	// server presents instead of the plain key.
+	HostCA ssh.Signer
+	// Questions, when set, enables keyboard-interactive authentication with
+	// these prompts; CheckAnswers decides whether the replies are right.
+	Questions    []string
+	CheckAnswers func(answers []string) bool
+	// AcceptEnv lists the variable name patterns env requests may set, like
+	// sshd's AcceptEnv. Nil accepts every variable.
+	AcceptEnv []string
+	// MaxSessions, when set, refuses sessions beyond this many open at once
+	// on one connection, like sshd's MaxSessions.
+	MaxSessions int
+
+	// Exec answers exec requests. When nil, commands run through the local
+	// /bin/sh so that tests can rely on real shell behaviour.
+	Exec func(req ExecRequest) ExecResult
+}
+
+type Server struct {
+	Host string
+	Port int
+
+	config   Config
+	listener net.Listener
+	sshCfg   *ssh.ServerConfig
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	accepted int
+	commands []string
+	closed   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Start starts a server for cfg and stops it when the test ends.
+func Start(t testing.TB, cfg Config) *Server {
+	t.Helper()
+	if cfg.User == "" {
+		cfg.User = "test"
+	}
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		config: cfg,
+		conns:  map[net.Conn]struct{}{},
+		closed: make(chan struct{}),
+	}
+	s.sshCfg = &ssh.ServerConfig{
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	if len(cfg.Questions) > 0 {
+		s.sshCfg.KeyboardInteractiveCallback = s.checkKeyboardInteractive
+	}
+	if cfg.HostCA != nil {
+		cert := SignCert(t, cfg.HostCA, hostSigner.PublicKey(), ssh.HostCert, []string{"127.0.0.1"}, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+		if hostSigner, err = ssh.NewCertSigner(cert, hostSigner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.sshCfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = l
+	addr := l.Addr().(*net.TCPAddr)
+	s.Host = addr.IP.String()
+	s.Port = addr.Port
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// Commands returns the exec commands received so far.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *Server) Close() {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	close(s.closed)
+	s.listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) checkPassword(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if meta.User() == s.config.User && s.config.Password != "" && string(password) == s.config.Password {
+		return nil, nil
+	}
+	return nil, errors.New("password rejected")
+}
+
+func (s *Server) checkPublicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if _, ok := key.(*ssh.Certificate); ok && s.config.UserCA != nil && meta.User() == s.config.User {
+		checker := &ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), s.config.UserCA.Marshal())
+		}}
+		return checker.Authenticate(meta, key)
+	}
+	if meta.User() == s.config.User {
+		for _, k := range s.config.PublicKeys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+		}
+	}
+	return nil, errors.New("public key rejected")
+}
+
+func (s *Server) checkKeyboardInteractive(meta ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+	echos := make([]bool, len(s.config.Questions))
+	answers, err := client(meta.User(), "sshtest login", s.config.Questions, echos)
+	if err != nil {
+		return nil, err
+	}
+	if meta.User() == s.config.User && s.config.CheckAnswers != nil && s.config.CheckAnswers(answers) {
+		return nil, nil
+	}
+	return nil, errors.New("keyboard-interactive rejected")
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.accepted++
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.sshCfg)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.handleGlobal(sconn, reqs)
+	}()
+
+	var sessions atomic.Int32
+	for newCh := range chans {
+		if newCh.ChannelType() == "direct-tcpip" {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handleDirect(newCh)
+			}()
+			continue
+		}
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		if s.config.MaxSessions > 0 && int(sessions.Load()) >= s.config.MaxSessions {
+			newCh.Reject(ssh.Prohibited, "open failed")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		sessions.Add(1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleSession(ch, chReqs, func() { sessions.Add(-1) })
+		}()
+	}
+}
+
+// handleGlobal serves tcpip-forward requests by listening on the loopback
+// interface and opening a forwarded-tcpip channel for each connection.
+func (s *Server) handleGlobal(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	type forwardMsg struct {
+		Addr string
+		Port uint32
+	}
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for req := range reqs {
+		var msg forwardMsg
+		switch req.Type {
+		case "tcpip-forward":
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(msg.Port))))
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			port := uint32(l.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(msg.Addr, strconv.Itoa(int(port)))] = l
+			req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.acceptForwarded(conn, l, msg.Addr, port)
+			}()
+		case "cancel-tcpip-forward":
+			ssh.Unmarshal(req.Payload, &msg)
+			key := net.JoinHostPort(msg.Addr, strconv.Itoa(int(msg.Port)))
+			if l, ok := listeners[key]; ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			req.Reply(true, nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) acceptForwarded(conn *ssh.ServerConn, l net.Listener, addr string, port uint32) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		origin := c.RemoteAddr().(*net.TCPAddr)
+		payload := ssh.Marshal(struct {
+			Addr       string
+			Port       uint32
+			OriginAddr string
+			OriginPort uint32
+		}{addr, port, origin.IP.String(), uint32(origin.Port)})
+		ch, reqs, err := conn.OpenChannel("forwarded-tcpip", payload)
+		if err != nil {
+			c.Close()
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			pipe(ch, c, s.closed)
+		}()
+	}
+}
+
+// handleDirect serves direct-tcpip channels by dialing the requested
+// address from the server side.
+func (s *Server) handleDirect(newCh ssh.NewChannel) {
+	var payload struct {
+		DestAddr string
+		DestPort uint32
+		OrigAddr string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &payload); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.DestAddr, strconv.Itoa(int(payload.DestPort))))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn, s.closed)
+}
+
+func pipe(ch ssh.Channel, conn net.Conn, closed <-chan struct{}) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, ch)
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-closed:
+			i = 2
+		}
+	}
+	ch.Close()
+	conn.Close()
+}
+
+// handleSession serves one session channel and calls release before closing
+// it.
+func (s *Server) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request, release func()) {
+	defer ch.Close()
+	defer release()
+	env := map[string]string{}
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			if !s.acceptEnv(kv.Name) {
+				req.Reply(false, nil)
+				continue
+			}
+			env[kv.Name] = kv.Value
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			s.mu.Lock()
+			s.commands = append(s.commands, payload.Command)
+			s.mu.Unlock()
+			s.exec(ch, reqs, ExecRequest{Command: payload.Command, Stdin: ch, Env: env})
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (s *Server) acceptEnv(name string) bool {
+	if s.config.AcceptEnv == nil {
+		return true
+	}
+	for _, pattern := range s.config.AcceptEnv {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) exec(ch ssh.Channel, reqs <-chan *ssh.Request, req ExecRequest) {
+	handler := s.config.Exec
+	if handler == nil {
+		handler = runLocal
+	}
+	res := handler(req)
+	if res.Hang {
+		// Wait for the client to close the channel or the server to stop.
+		done := make(chan struct{})
+		go func() {
+			for r := range reqs {
+				r.Reply(false, nil)
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-s.closed:
+		}
+		return
+	}
+	io.WriteString(ch, res.Stdout)
+	io.WriteString(ch.Stderr(), res.Stderr)
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(res.ExitCode)}))
+}
+
+func runLocal(req ExecRequest) ExecResult {
+	cmd := exec.Command("/bin/sh", "-c", req.Command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	for k, v := range req.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	err := cmd.Run()
+	res := ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		res.Stderr += err.Error()
+		res.ExitCode = 127
+	}
+	return res
+}
+
+// GenerateKey creates an ed25519 client key, writes its private half in
+// OpenSSH PEM format to a temporary file and returns the signer and path.
+func GenerateKey(t testing.TB) (ssh.Signer, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "sshtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, path
+}
+
+// SignCert signs pub with ca into a certificate of the given type for
+// principals, valid between from and until.
+func SignCert(t testing.TB, ca ssh.Signer, pub ssh.PublicKey, certType uint32, principals []string, from, until time.Time) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          1,
+		CertType:        certType,
+		KeyId:           "sshtest",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(from.Unix()),
+		ValidBefore:     uint64(until.Unix()),
+	}
+	if certType == ssh.UserCert {
+		cert.Permissions.Extensions = map[string]string{"permit-pty": ""}
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// WriteUserCert signs the key at keyPath for principals and writes the
+// certificate next to it as keyPath-cert.pub, where OpenSSH looks for it.
+func WriteUserCert(t testing.TB, ca, key ssh.Signer, keyPath string, principals []string, from, until time.Time) {
+	t.Helper()
+	cert := SignCert(t, ca, key.PublicKey(), ssh.UserCert, principals, from, until)
+	if err := os.WriteFile(keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,204 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseINI reads an Ansible-style INI inventory. Hosts are listed under
+// [group] sections with key=value variables; [group:vars] sets variables for
+// every member and [group:children] nests groups. ansible_host, ansible_user,
+// ansible_port, ansible_ssh_private_key_file and a ProxyJump in
+// ansible_ssh_common_args map to host fields; other variables become tags.
+func parseINI(data []byte) ([]*Host, error) {
+	type hostVars struct {
+		vars   map[string]string
+		groups map[string]bool
+	}
+	hosts := map[string]*hostVars{}
+	groupVars := map[string]map[string]string{}
+	children := map[string][]string{}
+
+	section, kind := "ungrouped", ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header", lineNo)
+			}
+			section, kind, _ = strings.Cut(line[1:len(line)-1], ":")
+			if kind != "" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %q", lineNo, kind)
+			}
+			continue
+		}
+		fields, err := splitINIFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		switch kind {
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key=value", lineNo)
+			}
+			if groupVars[section] == nil {
+				groupVars[section] = map[string]string{}
+			}
+			groupVars[section][strings.TrimSpace(key)] = unquote(strings.TrimSpace(value))
+		case "children":
+			children[section] = append(children[section], fields[0])
+		default:
+			name := fields[0]
+			h, ok := hosts[name]
+			if !ok {
+				h = &hostVars{vars: map[string]string{}, groups: map[string]bool{}}
+				hosts[name] = h
+			}
+			if section != "ungrouped" {
+				h.groups[section] = true
+			}
+			for _, f := range fields[1:] {
+				key, value, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: expected key=value, got %q", lineNo, f)
+				}
+				h.vars[key] = unquote(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Expand nested groups until membership stops changing.
+	for changed := true; changed; {
+		changed = false
+		for parent, kids := range children {
+			for _, h := range hosts {
+				if h.groups[parent] {
+					continue
+				}
+				for _, kid := range kids {
+					if h.groups[kid] {
+						h.groups[parent] = true
+						changed = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]*Host, 0, len(hosts))
+	for _, name := range names {
+		hv := hosts[name]
+		vars := map[string]string{}
+		groups := make([]string, 0, len(hv.groups))
+		for g := range hv.groups {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+		for _, g := range groups {
+			for k, v := range groupVars[g] {
+				vars[k] = v
+			}
+		}
+		for k, v := range hv.vars {
+			vars[k] = v
+		}
+
+		h := &Host{Name: name, Groups: groups, Tags: map[string]string{}}
+		for k, v := range vars {
+			switch k {
+			case "ansible_host":
+				h.Address = v
+			case "ansible_user", "ansible_ssh_user":
+				h.User = v
+			case "ansible_port", "ansible_ssh_port":
+				port, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("host %q: invalid %s %q", name, k, v)
+				}
+				h.Port = port
+			case "ansible_ssh_private_key_file":
+				h.KeyPath = v
+			case "ansible_ssh_common_args":
+				h.Jump = proxyJump(v)
+			default:
+				if !strings.HasPrefix(k, "ansible_") {
+					h.Tags[k] = v
+				}
+			}
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func splitINIFields(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			cur.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			cur.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func proxyJump(args string) string {
+	for _, f := range strings.Fields(args) {
+		if v, ok := strings.CutPrefix(f, "ProxyJump="); ok {
+			return v
+		}
+	}
+	if i := strings.Index(args, "-J "); i >= 0 {
+		if f := strings.Fields(args[i+3:]); len(f) > 0 {
+			return f[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+// Package inventory loads host inventories with groups and tags from YAML
+// or Ansible-style INI files.
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Host struct {
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	User    string            `json:"user,omitempty"`
+	Port    int               `json:"port,omitempty"`
+	KeyPath string            `json:"key,omitempty"`
+	Jump    string            `json:"jump,omitempty"`
+	Groups  []string          `json:"groups,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Tools   []Tool            `json:"tools,omitempty"`
+}
+
+// Tool is a fixed command offered as an MCP tool of its own while its host
+// is connected.
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command"`
+}
+
+func (h *Host) InGroup(group string) bool {
+	for _, g := range h.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether h carries tag. A tag of the form key=value must
+// match the value; a bare key matches any value.
+func (h *Host) HasTag(tag string) bool {
+	key, value, hasValue := strings.Cut(tag, "=")
+	v, ok := h.Tags[key]
+	return ok && (!hasValue || v == value)
+}
+
+type Inventory struct {
+	hosts map[string]*Host
+}
+
+func New(hosts []*Host) (*Inventory, error) {
+	inv := &Inventory{hosts: map[string]*Host{}}
+	toolHosts := map[string]string{}
+	for _, h := range hosts {
+		if h.Name == "" {
+			return nil, fmt.Errorf("inventory: host without a name")
+		}
+		if _, dup := inv.hosts[h.Name]; dup {
+			return nil, fmt.Errorf("inventory: duplicate host %q", h.Name)
+		}
+		if h.Address == "" {
+			h.Address = h.Name
+		}
+		for _, tool := range h.Tools {
+			if err := checkTool(tool); err != nil {
+				return nil, fmt.Errorf("inventory: host %q: %w", h.Name, err)
+			}
+			if other, dup := toolHosts[tool.Name]; dup {
+				return nil, fmt.Errorf("inventory: tool %q is defined by both %q and %q", tool.Name, other, h.Name)
+			}
+			toolHosts[tool.Name] = h.Name
+		}
+		sort.Strings(h.Groups)
+		inv.hosts[h.Name] = h
+	}
+	return inv, nil
+}
+
+// checkTool rejects tools whose name is not a valid MCP tool name or that
+// have no command.
+func checkTool(tool Tool) error {
+	if tool.Name == "" || len(tool.Name) > 64 {
+		return fmt.Errorf("tool name %q must be 1 to 64 characters", tool.Name)
+	}
+	for _, r := range tool.Name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return fmt.Errorf("tool name %q may only contain letters, digits, _ and -", tool.Name)
+		}
+	}
+	if tool.Command == "" {
+		return fmt.Errorf("tool %q has no command", tool.Name)
+	}
+	return nil
+}
+
+// Load reads an inventory file. Files ending in .yaml, .yml or .json are
+// parsed as YAML; anything else as Ansible-style INI.
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*Host
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		hosts, err = parseYAML(data)
+	default:
+		hosts, err = parseINI(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return New(hosts)
+}
+
+func (inv *Inventory) Lookup(name string) (*Host, bool) {
+	if inv == nil {
+		return nil, false
+	}
+	h, ok := inv.hosts[name]
+	return h, ok
+}
+
+// Hosts returns all hosts sorted by name.
+func (inv *Inventory) Hosts() []*Host {
+	if inv == nil {
+		return nil
+	}
+	hosts := make([]*Host, 0, len(inv.hosts))
+	for _, h := range inv.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return hosts
+}
+
+// Filter returns the hosts in group (if set) carrying tag (if set).
+func (inv *Inventory) Filter(group, tag string) []*Host {
+	var out []*Host
+	for _, h := range inv.Hosts() {
+		if group != "" && !h.InGroup(group) {
+			continue
+		}
+		if tag != "" && !h.HasTag(tag) {
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// Select resolves a selector to host names. Selectors are a host name,
+// "group:<name>", "tag:<key>[=<value>]" or "all".
+func (inv *Inventory) Select(selector string) ([]string, error) {
+	var hosts []*Host
+	switch {
+	case selector == "all":
+		hosts = inv.Hosts()
+	case strings.HasPrefix(selector, "group:"):
+		hosts = inv.Filter(strings.TrimPrefix(selector, "group:"), "")
+	case strings.HasPrefix(selector, "tag:"):
+		hosts = inv.Filter("", strings.TrimPrefix(selector, "tag:"))
+	default:
+		if _, ok := inv.Lookup(selector); !ok {
+			return nil, fmt.Errorf("unknown host %q", selector)
+		}
+		return []string{selector}, nil
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("selector %q matches no hosts", selector)
+	}
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.Name
+	}
+	return names, nil
+}
+
+// IsSelector reports whether s is a group, tag or "all" selector rather than
+// a single host.
+func IsSelector(s string) bool {
+	return s == "all" || strings.HasPrefix(s, "group:") || strings.HasPrefix(s, "tag:")
+}
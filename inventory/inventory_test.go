@@ -0,0 +1,170 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeFile(t, "hosts.yaml", `
+defaults:
+  user: deploy
+  tags: {team: ops}
+hosts:
+  bastion:
+    address: bastion.example.com
+  web1:
+    address: 10.0.0.11
+    port: 2222
+    groups: [web]
+    tags: {env: staging}
+    jump: bastion
+  web2:
+    address: 10.0.0.12
+    user: root
+    groups: [web]
+    tags: {env: prod}
+  db1: {}
+groups:
+  db: [db1]
+`)
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web1, ok := inv.Lookup("web1")
+	if !ok {
+		t.Fatal("web1 missing")
+	}
+	want := &Host{
+		Name: "web1", Address: "10.0.0.11", User: "deploy", Port: 2222, Jump: "bastion",
+		Groups: []string{"web"}, Tags: map[string]string{"team": "ops", "env": "staging"},
+	}
+	if !reflect.DeepEqual(web1, want) {
+		t.Errorf("web1 = %+v, want %+v", web1, want)
+	}
+	if db1, _ := inv.Lookup("db1"); db1.Address != "db1" || !db1.InGroup("db") {
+		t.Errorf("db1 = %+v", db1)
+	}
+
+	for selector, want := range map[string][]string{
+		"group:web":       {"web1", "web2"},
+		"tag:env=staging": {"web1"},
+		"tag:team":        {"bastion", "db1", "web1", "web2"},
+		"web2":            {"web2"},
+		"all":             {"bastion", "db1", "web1", "web2"},
+	} {
+		got, err := inv.Select(selector)
+		if err != nil {
+			t.Errorf("%s: %v", selector, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", selector, got, want)
+		}
+	}
+	for _, selector := range []string{"group:nope", "tag:env=dev", "web9"} {
+		if _, err := inv.Select(selector); err == nil {
+			t.Errorf("%s matched", selector)
+		}
+	}
+}
+
+func TestLoadYAMLUnknownField(t *testing.T) {
+	path := writeFile(t, "hosts.yml", "hosts:\n  web1:\n    adress: 10.0.0.1\n")
+	if _, err := Load(path); err == nil {
+		t.Fatal("misspelled field accepted")
+	}
+}
+
+func TestLoadINI(t *testing.T) {
+	path := writeFile(t, "hosts", `
+# web tier
+[web]
+web1 ansible_host=10.0.0.11 ansible_user=deploy env=staging
+web2 ansible_host=10.0.0.12 ansible_port=2222 ansible_ssh_common_args='-o ProxyJump=bastion'
+
+[web:vars]
+role=frontend
+
+[db]
+db1 ansible_ssh_private_key_file=~/.ssh/db
+
+[prod:children]
+web
+db
+
+[ungrouped]
+bastion
+`)
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web2, _ := inv.Lookup("web2")
+	want := &Host{
+		Name: "web2", Address: "10.0.0.12", Port: 2222, Jump: "bastion",
+		Groups: []string{"prod", "web"}, Tags: map[string]string{"role": "frontend"},
+	}
+	if !reflect.DeepEqual(web2, want) {
+		t.Errorf("web2 = %+v, want %+v", web2, want)
+	}
+	if web1, _ := inv.Lookup("web1"); web1.User != "deploy" || web1.Tags["env"] != "staging" {
+		t.Errorf("web1 = %+v", web1)
+	}
+	if db1, _ := inv.Lookup("db1"); db1.KeyPath != "~/.ssh/db" {
+		t.Errorf("db1 = %+v", db1)
+	}
+	if got, _ := inv.Select("group:prod"); !reflect.DeepEqual(got, []string{"db1", "web1", "web2"}) {
+		t.Errorf("group:prod = %v", got)
+	}
+}
+
+func TestLoadYAMLTools(t *testing.T) {
+	path := writeFile(t, "hosts.yaml", `
+hosts:
+  web1:
+    tools:
+      web1_restart:
+        description: Restart nginx
+        command: sudo systemctl restart nginx
+      web1_status:
+        command: systemctl status nginx
+`)
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web1, _ := inv.Lookup("web1")
+	want := []Tool{
+		{Name: "web1_restart", Description: "Restart nginx", Command: "sudo systemctl restart nginx"},
+		{Name: "web1_status", Command: "systemctl status nginx"},
+	}
+	if !reflect.DeepEqual(web1.Tools, want) {
+		t.Errorf("tools = %+v", web1.Tools)
+	}
+
+	for name, content := range map[string]string{
+		"bad name":   "hosts:\n  web1:\n    tools:\n      restart nginx: {command: x}\n",
+		"no command": "hosts:\n  web1:\n    tools:\n      restart: {}\n",
+		"duplicate":  "hosts:\n  a:\n    tools:\n      t: {command: x}\n  b:\n    tools:\n      t: {command: y}\n",
+		"defaults":   "defaults:\n  tools:\n    t: {command: x}\nhosts:\n  a: {}\n",
+	} {
+		if _, err := Load(writeFile(t, "bad.yaml", content)); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
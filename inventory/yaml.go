@@ -0,0 +1,127 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFile is the YAML inventory layout:
+//
+//	defaults:
+//	  user: deploy
+//	hosts:
+//	  web1:
+//	    address: 10.0.0.11
+//	    groups: [web]
+//	    tags: {env: staging}
+//	    jump: bastion
+//	    tools:
+//	      restart_web1_nginx:
+//	        description: Restart nginx on web1
+//	        command: sudo systemctl restart nginx
+//	groups:
+//	  db: [db1, db2]
+type yamlFile struct {
+	Defaults yamlHost            `yaml:"defaults"`
+	Hosts    map[string]yamlHost `yaml:"hosts"`
+	Groups   map[string][]string `yaml:"groups"`
+}
+
+type yamlHost struct {
+	Address string              `yaml:"address"`
+	User    string              `yaml:"user"`
+	Port    int                 `yaml:"port"`
+	Key     string              `yaml:"key"`
+	Jump    string              `yaml:"jump"`
+	Groups  []string            `yaml:"groups"`
+	Tags    map[string]string   `yaml:"tags"`
+	Tools   map[string]yamlTool `yaml:"tools"`
+}
+
+type yamlTool struct {
+	Description string `yaml:"description"`
+	Command     string `yaml:"command"`
+}
+
+func parseYAML(data []byte) ([]*Host, error) {
+	var f yamlFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(f.Defaults.Tools) > 0 {
+		return nil, fmt.Errorf("defaults: tools must be set per host")
+	}
+
+	hosts := map[string]*Host{}
+	for name, y := range f.Hosts {
+		h := &Host{
+			Name:    name,
+			Address: y.Address,
+			User:    firstNonEmpty(y.User, f.Defaults.User),
+			Port:    y.Port,
+			KeyPath: firstNonEmpty(y.Key, f.Defaults.Key),
+			Jump:    firstNonEmpty(y.Jump, f.Defaults.Jump),
+			Groups:  append([]string(nil), y.Groups...),
+			Tags:    map[string]string{},
+		}
+		if h.Port == 0 {
+			h.Port = f.Defaults.Port
+		}
+		for k, v := range f.Defaults.Tags {
+			h.Tags[k] = v
+		}
+		for k, v := range y.Tags {
+			h.Tags[k] = v
+		}
+		for _, name := range sortedKeys(y.Tools) {
+			h.Tools = append(h.Tools, Tool{Name: name, Description: y.Tools[name].Description, Command: y.Tools[name].Command})
+		}
+		hosts[name] = h
+	}
+	for group, members := range f.Groups {
+		for _, name := range members {
+			h, ok := hosts[name]
+			if !ok {
+				return nil, fmt.Errorf("group %q: unknown host %q", group, name)
+			}
+			if !h.InGroup(group) {
+				h.Groups = append(h.Groups, group)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]*Host, len(names))
+	for i, name := range names {
+		out[i] = hosts[name]
+	}
+	return out, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,254 +1,305 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/ssh"
+	"ssh-executor/config"
+	"ssh-executor/executor"
+	"ssh-executor/inventory"
+	"ssh-executor/mcp"
+	"ssh-executor/policy"
+	"ssh-executor/redact"
+	"ssh-executor/tools"
 )
 
-type SSHExecutor struct {
-	client *ssh.Client
+// loadConfig returns the settings of the file named by SSH_CONFIG_FILE,
+// completed by the SSH_* environment variables.
+func loadConfig() (*config.File, error) {
+	env, err := config.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	path := os.Getenv("SSH_CONFIG_FILE")
+	if path == "" {
+		return env, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Merge(env)
+	return cfg, nil
 }
 
-func (s *SSHExecutor) Connect() error {
-	host := os.Getenv("SSH_HOST")
-	user := os.Getenv("SSH_USER")
-	password := os.Getenv("SSH_PASSWORD")
-	keyPath := os.Getenv("SSH_PRIVATE_KEY_PATH")
-	portStr := os.Getenv("SSH_PORT")
-	if portStr == "" {
-		portStr = "22"
-	}
-	port, _ := strconv.Atoi(portStr)
+// settings are the parts of a config that can be applied to a running
+// server, with every file they name read.
+type settings struct {
+	inventory      *inventory.Inventory
+	groups         map[string][]string
+	base           executor.SSHConfig
+	sudoPassword   string
+	policy         *policy.Policy
+	redactor       *redact.Redactor
+	level          slog.Level
+	maxOutputBytes int
+	concurrency    int
+	connectTimeout time.Duration
+	commandTimeout time.Duration
+}
 
-	if host == "" || user == "" {
-		return fmt.Errorf("SSH_HOST and SSH_USER required")
+func newSettings(cfg *config.File) (*settings, error) {
+	st := &settings{
+		groups:         cfg.Groups,
+		sudoPassword:   cfg.Sudo.Password,
+		level:          slog.LevelInfo,
+		maxOutputBytes: cfg.Limits.MaxOutputBytes,
+		concurrency:    cfg.Limits.FleetConcurrency,
+		connectTimeout: cfg.Timeouts.Connect.Value(),
+		commandTimeout: cfg.Timeouts.Command.Value(),
+		base: executor.SSHConfig{
+			Host:       cfg.SSH.Host,
+			Port:       cfg.SSH.Port,
+			User:       cfg.SSH.User,
+			Password:   cfg.SSH.Password,
+			KeyPath:    cfg.SSH.Key,
+			CertPath:   cfg.SSH.Certificate,
+			HostCAPath: cfg.SSH.HostCAKeys,
+			Pool: executor.PoolConfig{
+				MaxConnections: cfg.Pool.MaxConnections,
+				MaxSessions:    cfg.Pool.MaxSessions,
+				QueueTimeout:   cfg.Pool.QueueTimeout.Value(),
+				IdleTimeout:    cfg.Pool.IdleTimeout.Value(),
+			},
+		},
 	}
-
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	if st.base.Port == 0 {
+		st.base.Port = 22
 	}
-
-	if password != "" {
-		config.Auth = append(config.Auth, ssh.Password(password))
+	var err error
+	if st.inventory, err = loadInventory(cfg); err != nil {
+		return nil, err
 	}
-
-	if keyPath != "" {
-		key, err := os.ReadFile(keyPath)
+	if st.base.KeyboardInteractive, err = keyboardInteractive(cfg.SSH.KeyboardInteractive); err != nil {
+		return nil, err
+	}
+	if cfg.Sudo.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.Sudo.PasswordFile)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("sudo password file: %w", err)
 		}
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return err
+		st.sudoPassword = strings.TrimRight(string(data), "\r\n")
+	}
+	if st.policy, err = loadPolicy(cfg.Policy); err != nil {
+		return nil, err
+	}
+	st.redactor = redact.Default()
+	if cfg.Redact.File != "" {
+		if st.redactor, err = redact.Load(cfg.Redact.File); err != nil {
+			return nil, err
 		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
 	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
-	if err != nil {
-		return err
+	if cfg.Logging.Level != "" {
+		if st.level, err = mcp.ParseLevel(cfg.Logging.Level); err != nil {
+			return nil, fmt.Errorf("log level: %w", err)
+		}
 	}
-
-	s.client = client
-	return nil
+	return st, nil
 }
 
-func (s *SSHExecutor) ExecuteCommand(cmd string) (string, string, error) {
-	if s.client == nil {
-		return "", "", fmt.Errorf("not connected")
+// loadInventory combines the hosts of the inventory file with those defined
+// in the config. It returns nil when there are neither.
+func loadInventory(cfg *config.File) (*inventory.Inventory, error) {
+	var hosts []*inventory.Host
+	if cfg.Inventory != "" {
+		inv, err := inventory.Load(cfg.Inventory)
+		if err != nil {
+			return nil, err
+		}
+		hosts = inv.Hosts()
 	}
-
-	session, err := s.client.NewSession()
-	if err != nil {
-		return "", "", err
+	hosts = append(hosts, cfg.InventoryHosts()...)
+	if cfg.Inventory == "" && len(hosts) == 0 {
+		return nil, nil
 	}
-	defer session.Close()
+	return inventory.New(hosts)
+}
 
-	output, err := session.CombinedOutput(cmd)
-	if err != nil {
-		return "", string(output), err
+// keyboardInteractive returns the static keyboard-interactive answers and
+// the TOTP secret, read from its file when one is named.
+func keyboardInteractive(cfg config.KeyboardInteractive) (executor.KeyboardInteractive, error) {
+	k := executor.KeyboardInteractive{Responses: cfg.Responses, TOTPSecret: cfg.TOTPSecret}
+	if cfg.TOTPSecretFile != "" {
+		data, err := os.ReadFile(cfg.TOTPSecretFile)
+		if err != nil {
+			return k, fmt.Errorf("TOTP secret file: %w", err)
+		}
+		k.TOTPSecret = strings.TrimSpace(string(data))
 	}
-
-	return string(output), "", nil
+	if k.TOTPSecret != "" {
+		if _, err := executor.TOTP(k.TOTPSecret, time.Now()); err != nil {
+			return k, err
+		}
+	}
+	return k, nil
 }
 
-func (s *SSHExecutor) Disconnect() {
-	if s.client != nil {
-		s.client.Close()
-		s.client = nil
+// loadPolicy returns the rules of the config, followed by those of the
+// policy file or the built-in ones.
+func loadPolicy(cfg config.Policy) (*policy.Policy, error) {
+	pol := policy.Default()
+	if cfg.File != "" {
+		var err error
+		if pol, err = policy.Load(cfg.File); err != nil {
+			return nil, err
+		}
 	}
+	rules := make([]policy.Rule, 0, len(cfg.Rules)+len(pol.Rules))
+	for i, r := range cfg.Rules {
+		rule, err := policy.NewRule(r.Name, r.Pattern, policy.Action(r.Action), r.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	pol.Rules = append(rules, pol.Rules...)
+	return pol, nil
 }
 
-type JSONRPCRequest struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Id *int `json:"id,omitempty"`
-	Method string `json:"method"`
-	Params interface{} `json:"params,omitempty"`
+func newTargets(server *mcp.Server, logger *slog.Logger, transport string) (*tools.Targets, error) {
+	targets := tools.NewTargets(nil, executor.SSHConfig{})
+	targets.Logger = logger
+	targets.Changed = server.ToolsChanged
+	switch transport {
+	case "", "ssh":
+	case "local":
+		targets.NewExecutor = func(name string) (executor.Executor, error) {
+			return executor.NewLocalExecutor(), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown SSH_TRANSPORT %q", transport)
+	}
+	return targets, nil
 }
 
-type JSONRPCResponse struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Id int `json:"id"`
-	Result interface{} `json:"result,omitempty"`
-	Error *JSONRPCError `json:"error,omitempty"`
+// newLogger returns a logger sending records to the client and mirroring
+// them to the log file, or stderr, from level up. Nothing is written to
+// stdout, which carries the protocol.
+func newLogger(server *mcp.Server, file string, level *slog.LevelVar) (*slog.Logger, io.Closer, error) {
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("log file: %w", err)
+		}
+		out = f
+	}
+	mirror := slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				a.Value = slog.StringValue(mcp.LevelName(a.Value.Any().(slog.Level)))
+			}
+			return a
+		},
+	})
+	return slog.New(server.LogHandler(mirror)), out, nil
 }
 
-type JSONRPCError struct {
-	Code int `json:"code"`
-	Message string `json:"message"`
+// newAudit returns a logger appending a JSON line per record to file, or
+// nil when no file is named.
+func newAudit(file string) (*slog.Logger, io.Closer, error) {
+	if file == "" {
+		return nil, nopCloser{}, nil
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("audit file: %w", err)
+	}
+	return slog.New(slog.NewJSONHandler(f, nil)), f, nil
 }
 
-type Tool struct {
-	Name string `json:"name"`
-	Description string `json:"description"`
-	InputSchema map[string]interface{} `json:"inputSchema"`
-}
+type nopCloser struct{ io.Writer }
 
-type ListToolsResult struct {
-	Tools []Tool `json:"tools"`
-}
+func (nopCloser) Close() error { return nil }
 
-type CallToolResult struct {
-	Content []Content `json:"content"`
-	IsError bool `json:"isError,omitempty"`
-}
+func run(stdin io.Reader, stdout io.Writer) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	st, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
 
-type Content struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	server := mcp.NewServer("ssh-executor", "1.0.0")
+	level := &slog.LevelVar{}
+	level.Set(st.level)
+	logger, logOut, err := newLogger(server, cfg.Logging.File, level)
+	if err != nil {
+		return err
+	}
+	defer logOut.Close()
+	audit, auditOut, err := newAudit(cfg.Audit.File)
+	if err != nil {
+		return err
+	}
+	defer auditOut.Close()
+	targets, err := newTargets(server, logger, cfg.Transport)
+	if err != nil {
+		return err
+	}
+	defer targets.CloseAll()
+
+	redactor := redact.NewReloadable(st.redactor)
+	server.AddResultFilter(tools.RedactResults(redactor))
+	server.AddResourceFilter(tools.RedactResources(redactor))
+	guard := tools.NewGuard(server, st.policy)
+	guard.Logger = logger
+	guard.Audit = audit
+
+	r := &reloader{
+		file:     os.Getenv("SSH_CONFIG_FILE"),
+		server:   server,
+		targets:  targets,
+		guard:    guard,
+		redactor: redactor,
+		level:    level,
+		logger:   logger,
+	}
+	r.apply(cfg, st)
+
+	tools.Register(server, targets, guard)
+	tools.RegisterFleet(server, targets, guard)
+	tools.RegisterScript(server, targets, guard)
+	tools.RegisterInventory(server, targets)
+	tools.RegisterForwards(server, targets)
+	tools.RegisterHTTP(server, targets)
+	tools.RegisterPool(server, targets)
+	tools.RegisterConfig(server, r.current)
+	if r.hostTools, err = tools.RegisterHostTools(server, targets, guard); err != nil {
+		return err
+	}
+	tools.RegisterResources(server, targets)
+	if err := tools.RegisterPrompts(server, targets, cfg.PromptsDir); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.watch(ctx, configPollInterval)
+	return server.Serve(stdin, stdout)
 }
 
 func main() {
-	executor := &SSHExecutor{}
-
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Text()
-		var req JSONRPCRequest
-		if err := json.Unmarshal([]byte(line), &req); err != nil {
-			continue
-		}
-		if req.Id == nil {
-			continue
-		}
-		var result interface{}
-		var rpcErr *JSONRPCError
-		switch req.Method {
-		case "initialize":
-			result = map[string]interface{}{
-				"protocolVersion": "2024-11-05",
-				"capabilities": map[string]interface{}{
-					"tools": map[string]interface{}{},
-				},
-				"serverInfo": map[string]interface{}{
-					"name": "ssh-executor",
-					"version": "1.0.0",
-				},
-			}
-		case "tools/list":
-			result = ListToolsResult{
-				Tools: []Tool{
-					{
-						Name: "connect_ssh",
-						Description: "Connect to SSH server",
-						InputSchema: map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{},
-						},
-					},
-					{
-						Name: "execute_command",
-						Description: "Execute command on remote server",
-						InputSchema: map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{
-								"command": map[string]interface{}{
-									"type": "string",
-								},
-							},
-							"required": []string{"command"},
-						},
-					},
-					{
-						Name: "disconnect_ssh",
-						Description: "Disconnect from SSH server",
-						InputSchema: map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{},
-						},
-					},
-				},
-			}
-		case "tools/call":
-			params, ok := req.Params.(map[string]interface{})
-			if !ok {
-				rpcErr = &JSONRPCError{Code: -32602, Message: "Invalid params"}
-				break
-			}
-			name, ok := params["name"].(string)
-			if !ok {
-				rpcErr = &JSONRPCError{Code: -32602, Message: "Invalid params"}
-				break
-			}
-			args, _ := params["arguments"].(map[string]interface{})
-			switch name {
-			case "connect_ssh":
-				err := executor.Connect()
-				if err != nil {
-					result = CallToolResult{
-						Content: []Content{{Type: "text", Text: fmt.Sprintf("Connection failed: %v", err)}},
-						IsError: true,
-					}
-				} else {
-					result = CallToolResult{
-						Content: []Content{{Type: "text", Text: "Connected to SSH server"}},
-					}
-				}
-			case "execute_command":
-				cmd, ok := args["command"].(string)
-				if !ok {
-					result = CallToolResult{
-						Content: []Content{{Type: "text", Text: "command parameter required"}},
-						IsError: true,
-					}
-				} else {
-					output, stderr, err := executor.ExecuteCommand(cmd)
-					if err != nil {
-						result = CallToolResult{
-							Content: []Content{{Type: "text", Text: fmt.Sprintf("Command failed: %v\nOutput: %s\nError: %s", err, output, stderr)}},
-							IsError: true,
-						}
-					} else {
-						result = CallToolResult{
-							Content: []Content{{Type: "text", Text: fmt.Sprintf("Output:\n%s", output)}},
-						}
-					}
-				}
-			case "disconnect_ssh":
-				executor.Disconnect()
-				result = CallToolResult{
-					Content: []Content{{Type: "text", Text: "Disconnected from SSH server"}},
-				}
-			default:
-				rpcErr = &JSONRPCError{Code: -32601, Message: "Method not found"}
-			}
-		default:
-			rpcErr = &JSONRPCError{Code: -32601, Message: "Method not found"}
-		}
-		resp := JSONRPCResponse{
-			Jsonrpc: "2.0",
-			Id: *req.Id,
-			Result: result,
-			Error: rpcErr,
-		}
-		respBytes, _ := json.Marshal(resp)
-		fmt.Println(string(respBytes))
+	if err := run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
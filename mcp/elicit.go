@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrElicitationUnsupported is returned by Elicit when the client did not
+// declare the elicitation capability.
+var ErrElicitationUnsupported = errors.New("client does not support elicitation")
+
+type ElicitResult struct {
+	// Action is "accept", "decline" or "cancel".
+	Action  string                 `json:"action"`
+	Content map[string]interface{} `json:"content,omitempty"`
+}
+
+// Accepted reports whether the user accepted the request.
+func (r *ElicitResult) Accepted() bool {
+	return r.Action == "accept"
+}
+
+// Elicit asks the user, through the client, for input matching
+// requestedSchema, a flat object schema of primitive properties.
+func (s *Server) Elicit(ctx context.Context, message string, requestedSchema map[string]interface{}) (*ElicitResult, error) {
+	if !s.ClientSupports("elicitation") {
+		return nil, ErrElicitationUnsupported
+	}
+	var result ElicitResult
+	err := s.Request(ctx, "elicitation/create", map[string]interface{}{
+		"message":         message,
+		"requestedSchema": requestedSchema,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,170 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Levels for the MCP logging levels that have no slog counterpart. Debug,
+// info, warning and error map to the slog levels of the same name.
+const (
+	LevelNotice    = slog.Level(2)
+	LevelCritical  = slog.Level(12)
+	LevelAlert     = slog.Level(16)
+	LevelEmergency = slog.Level(20)
+)
+
+var levelNames = []struct {
+	name  string
+	level slog.Level
+}{
+	{"debug", slog.LevelDebug},
+	{"info", slog.LevelInfo},
+	{"notice", LevelNotice},
+	{"warning", slog.LevelWarn},
+	{"error", slog.LevelError},
+	{"critical", LevelCritical},
+	{"alert", LevelAlert},
+	{"emergency", LevelEmergency},
+}
+
+// ParseLevel returns the slog level for an MCP logging level name.
+func ParseLevel(name string) (slog.Level, error) {
+	for _, l := range levelNames {
+		if l.name == name {
+			return l.level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelName returns the MCP name of the highest MCP level not above l.
+func LevelName(l slog.Level) string {
+	name := levelNames[0].name
+	for _, ln := range levelNames {
+		if l >= ln.level {
+			name = ln.name
+		}
+	}
+	return name
+}
+
+// LogHandler returns a slog.Handler that sends records to the client as
+// notifications/message, at or above the level set with logging/setLevel
+// (info until the client sets one), and passes them on to mirror if it is
+// not nil. Records are sent under the logger named by their "logger"
+// attribute, or the server name. Calling LogHandler enables the logging
+// capability.
+func (s *Server) LogHandler(mirror slog.Handler) slog.Handler {
+	s.mu.Lock()
+	if s.logLevel == nil {
+		s.logLevel = new(atomic.Int64)
+		s.logLevel.Store(int64(slog.LevelInfo))
+	}
+	s.mu.Unlock()
+	return &logHandler{s: s, mirror: mirror}
+}
+
+func (s *Server) hasLogging() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logLevel != nil
+}
+
+type setLevelParams struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) handleSetLevel(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p setLevelParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	level, err := ParseLevel(p.Level)
+	if err != nil {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	s.mu.Lock()
+	logLevel := s.logLevel
+	s.mu.Unlock()
+	if logLevel == nil {
+		return nil, &JSONRPCError{Code: CodeMethodNotFound, Message: "Method not found"}
+	}
+	logLevel.Store(int64(level))
+	return map[string]interface{}{}, nil
+}
+
+type logHandler struct {
+	s      *Server
+	mirror slog.Handler
+	attrs  []slog.Attr
+	group  string
+}
+
+func (h *logHandler) clientEnabled(level slog.Level) bool {
+	return level >= slog.Level(h.s.logLevel.Load())
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.clientEnabled(level) || h.mirror != nil && h.mirror.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.mirror != nil && h.mirror.Enabled(ctx, r.Level) {
+		h.mirror.Handle(ctx, r)
+	}
+	if !h.clientEnabled(r.Level) {
+		return nil
+	}
+	logger := h.s.name
+	data := map[string]interface{}{"message": r.Message}
+	add := func(key string, v slog.Value) {
+		if key == "logger" {
+			logger = v.String()
+			return
+		}
+		value := v.Resolve().Any()
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		data[key] = value
+	}
+	// Attributes added through WithAttrs already carry their group prefix.
+	for _, a := range h.attrs {
+		add(a.Key, a.Value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(h.group+a.Key, a.Value)
+		return true
+	})
+	h.s.Notify("notifications/message", map[string]interface{}{
+		"level":  LevelName(r.Level),
+		"logger": logger,
+		"data":   data,
+	})
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	for _, a := range attrs {
+		a.Key = h.group + a.Key
+		h2.attrs = append(h2.attrs[:len(h2.attrs):len(h2.attrs)], a)
+	}
+	if h.mirror != nil {
+		h2.mirror = h.mirror.WithAttrs(attrs)
+	}
+	return &h2
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.group = h.group + name + "."
+	if h.mirror != nil {
+		h2.mirror = h.mirror.WithGroup(name)
+	}
+	return &h2
+}
@@ -0,0 +1,114 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type ListPromptsResult struct {
+	Prompts []Prompt `json:"prompts"`
+}
+
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+type PromptMessage struct {
+	Role    string        `json:"role"`
+	Content PromptContent `json:"content"`
+}
+
+// PromptContent is a text block or an embedded resource.
+type PromptContent struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// PromptHandler renders a prompt from its arguments. Required arguments are
+// checked before it is called.
+type PromptHandler func(ctx context.Context, args map[string]string) (*GetPromptResult, error)
+
+// AddPrompt registers a prompt, replacing any prompt with the same name.
+func (s *Server) AddPrompt(prompt Prompt, handler PromptHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prompts == nil {
+		s.prompts = map[string]PromptHandler{}
+	}
+	if _, exists := s.prompts[prompt.Name]; exists {
+		for i := range s.promptOrder {
+			if s.promptOrder[i].Name == prompt.Name {
+				s.promptOrder[i] = prompt
+			}
+		}
+	} else {
+		s.promptOrder = append(s.promptOrder, prompt)
+	}
+	s.prompts[prompt.Name] = handler
+}
+
+func (s *Server) hasPrompts() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.promptOrder) > 0
+}
+
+func (s *Server) handleListPrompts(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prompts := make([]Prompt, len(s.promptOrder))
+	copy(prompts, s.promptOrder)
+	return ListPromptsResult{Prompts: prompts}, nil
+}
+
+type getPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+func (s *Server) handleGetPrompt(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p getPromptParams
+	if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	s.mu.Lock()
+	handler, ok := s.prompts[p.Name]
+	var prompt Prompt
+	for _, pr := range s.promptOrder {
+		if pr.Name == p.Name {
+			prompt = pr
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("Unknown prompt %q", p.Name)}
+	}
+	for _, arg := range prompt.Arguments {
+		if arg.Required && p.Arguments[arg.Name] == "" {
+			return nil, &JSONRPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("Missing required argument %q", arg.Name)}
+		}
+	}
+	if p.Arguments == nil {
+		p.Arguments = map[string]string{}
+	}
+	result, err := handler(ctx, p.Arguments)
+	if err != nil {
+		return nil, &JSONRPCError{Code: CodeInternalError, Message: err.Error()}
+	}
+	return result, nil
+}
@@ -0,0 +1,299 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// CodeResourceNotFound is the error code for resources/read of an unknown
+// URI.
+const CodeResourceNotFound = -32002
+
+// ErrResourceNotFound can be returned by a ResourceHandler to report an
+// unknown resource with CodeResourceNotFound.
+var ErrResourceNotFound = errors.New("resource not found")
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplate describes a family of resources by an RFC 6570 URI
+// template with simple {name} variables.
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents holds either Text or base64-encoded Blob.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+type ListResourcesResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+type ListResourceTemplatesResult struct {
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+}
+
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// ResourceHandler reads the resource at uri. vars holds the values of the
+// template variables matched in uri.
+type ResourceHandler func(ctx context.Context, uri string, vars map[string]string) ([]ResourceContents, error)
+
+// ResourceLister returns the resources of a template that currently exist.
+type ResourceLister func(ctx context.Context) []Resource
+
+// ResourceFilter rewrites resource contents before they are sent to the
+// client. An error fails the read instead.
+type ResourceFilter func(uri string, contents *ResourceContents) error
+
+// ResourceWatcher watches resources for resources/subscribe.
+type ResourceWatcher interface {
+	// Watch starts watching uri and calls changed each time the resource
+	// changes. meta is sent as the _meta of the notification.
+	Watch(uri string, changed func(meta map[string]interface{})) error
+	// Unwatch stops watching uri.
+	Unwatch(uri string)
+}
+
+type resourceTemplate struct {
+	ResourceTemplate
+	read ResourceHandler
+	list ResourceLister
+}
+
+// AddResourceTemplate registers a URI template served by read. When list is
+// not nil, the resources it returns are included in resources/list. URIs are
+// matched against templates in registration order, so more specific templates
+// must be added first.
+func (s *Server) AddResourceTemplate(tmpl ResourceTemplate, read ResourceHandler, list ResourceLister) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates = append(s.templates, resourceTemplate{tmpl, read, list})
+}
+
+// AddResourceFilter runs f on the contents of every resource read, in the
+// order filters were added.
+func (s *Server) AddResourceFilter(f ResourceFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resourceFilters = append(s.resourceFilters, f)
+}
+
+// SetResourceWatcher enables resources/subscribe, served by w. Subscribers
+// get notifications/resources/updated whenever w reports a change.
+func (s *Server) SetResourceWatcher(w ResourceWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watcher = w
+}
+
+func (s *Server) hasResources() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.templates) > 0
+}
+
+func (s *Server) handleListResources(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	s.mu.Lock()
+	templates := s.templates
+	s.mu.Unlock()
+	resources := []Resource{}
+	for _, t := range templates {
+		if t.list != nil {
+			resources = append(resources, t.list(ctx)...)
+		}
+	}
+	return ListResourcesResult{Resources: resources}, nil
+}
+
+func (s *Server) handleListResourceTemplates(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	templates := make([]ResourceTemplate, len(s.templates))
+	for i, t := range s.templates {
+		templates[i] = t.ResourceTemplate
+	}
+	return ListResourceTemplatesResult{ResourceTemplates: templates}, nil
+}
+
+type readResourceParams struct {
+	URI string `json:"uri"`
+}
+
+func (s *Server) handleReadResource(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p readResourceParams
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	s.mu.Lock()
+	templates := s.templates
+	filters := s.resourceFilters
+	s.mu.Unlock()
+	for _, t := range templates {
+		vars, ok := MatchTemplate(t.URITemplate, p.URI)
+		if !ok {
+			continue
+		}
+		contents, err := t.read(ctx, p.URI, vars)
+		if errors.Is(err, ErrResourceNotFound) {
+			return nil, &JSONRPCError{Code: CodeResourceNotFound, Message: err.Error()}
+		}
+		if err != nil {
+			return nil, &JSONRPCError{Code: CodeInternalError, Message: err.Error()}
+		}
+		for i := range contents {
+			for _, f := range filters {
+				if err := f(p.URI, &contents[i]); err != nil {
+					return nil, &JSONRPCError{Code: CodeInternalError, Message: err.Error()}
+				}
+			}
+		}
+		return ReadResourceResult{Contents: contents}, nil
+	}
+	return nil, &JSONRPCError{Code: CodeResourceNotFound, Message: "Resource not found"}
+}
+
+type subscribeParams struct {
+	URI string `json:"uri"`
+}
+
+func (s *Server) handleSubscribe(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p subscribeParams
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	s.mu.Lock()
+	w := s.watcher
+	matched := false
+	for _, t := range s.templates {
+		if _, ok := MatchTemplate(t.URITemplate, p.URI); ok {
+			matched = true
+			break
+		}
+	}
+	subscribed := s.subscriptions[p.URI]
+	s.mu.Unlock()
+	switch {
+	case w == nil:
+		return nil, &JSONRPCError{Code: CodeMethodNotFound, Message: "Method not found"}
+	case !matched:
+		return nil, &JSONRPCError{Code: CodeResourceNotFound, Message: "Resource not found"}
+	case subscribed:
+		return map[string]interface{}{}, nil
+	}
+
+	uri := p.URI
+	err := w.Watch(uri, func(meta map[string]interface{}) {
+		params := map[string]interface{}{"uri": uri}
+		if len(meta) > 0 {
+			params["_meta"] = meta
+		}
+		s.Notify("notifications/resources/updated", params)
+	})
+	if err != nil {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	s.mu.Lock()
+	if s.subscriptions == nil {
+		s.subscriptions = map[string]bool{}
+	}
+	s.subscriptions[uri] = true
+	s.mu.Unlock()
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) handleUnsubscribe(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p subscribeParams
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	s.mu.Lock()
+	w := s.watcher
+	subscribed := s.subscriptions[p.URI]
+	delete(s.subscriptions, p.URI)
+	s.mu.Unlock()
+	if w == nil {
+		return nil, &JSONRPCError{Code: CodeMethodNotFound, Message: "Method not found"}
+	}
+	if subscribed {
+		w.Unwatch(p.URI)
+	}
+	return map[string]interface{}{}, nil
+}
+
+// unwatchAll ends every subscription when the client goes away.
+func (s *Server) unwatchAll() {
+	s.mu.Lock()
+	w := s.watcher
+	subs := s.subscriptions
+	s.subscriptions = nil
+	s.mu.Unlock()
+	for uri := range subs {
+		w.Unwatch(uri)
+	}
+}
+
+// MatchTemplate matches uri against a URI template and returns the values
+// of its {name} variables. Variables match at least one character; only a
+// variable ending the template may contain "/".
+func MatchTemplate(tmpl, uri string) (map[string]string, bool) {
+	vars := map[string]string{}
+	for tmpl != "" {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			return vars, tmpl == uri
+		}
+		if !strings.HasPrefix(uri, tmpl[:open]) {
+			return nil, false
+		}
+		uri = uri[open:]
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return nil, false
+		}
+		name := tmpl[open+1 : open+end]
+		tmpl = tmpl[open+end+1:]
+
+		var value string
+		if next := strings.IndexByte(tmpl, '{'); next < 0 {
+			// The last variable takes everything up to the literal suffix.
+			if !strings.HasSuffix(uri, tmpl) {
+				return nil, false
+			}
+			value, uri = uri[:len(uri)-len(tmpl)], tmpl
+			if tmpl != "" && strings.Contains(value, "/") {
+				return nil, false
+			}
+		} else {
+			i := strings.Index(uri, tmpl[:next])
+			if i < 0 || next == 0 {
+				return nil, false
+			}
+			value, uri = uri[:i], uri[i:]
+			if strings.Contains(value, "/") {
+				return nil, false
+			}
+		}
+		if value == "" {
+			return nil, false
+		}
+		vars[name] = value
+	}
+	return vars, uri == ""
+}
@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		tmpl, uri string
+		want      map[string]string
+	}{
+		{"ssh://{host}/facts", "ssh://web1/facts", map[string]string{"host": "web1"}},
+		{"ssh://{host}/facts", "ssh://web1/etc/facts", nil},
+		{"ssh://{host}/{path}", "ssh://deploy@web1:22/etc/nginx/nginx.conf", map[string]string{"host": "deploy@web1:22", "path": "etc/nginx/nginx.conf"}},
+		{"ssh://{host}/{path}", "ssh://web1/", nil},
+		{"ssh://{host}/{path}", "ssh:///etc/hosts", nil},
+		{"file://{path}", "ssh://web1/x", nil},
+	} {
+		got, ok := MatchTemplate(tc.tmpl, tc.uri)
+		if !ok {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("MatchTemplate(%q, %q) = %v, %v; want %v", tc.tmpl, tc.uri, got, ok, tc.want)
+		}
+	}
+}
+
+type fakeWatcher struct {
+	changed chan func(meta map[string]interface{})
+	stopped chan string
+}
+
+func (w *fakeWatcher) Watch(uri string, changed func(meta map[string]interface{})) error {
+	w.changed <- changed
+	return nil
+}
+
+func (w *fakeWatcher) Unwatch(uri string) {
+	w.stopped <- uri
+}
+
+func TestResourceSubscription(t *testing.T) {
+	s := NewServer("test", "0")
+	s.AddResourceTemplate(ResourceTemplate{URITemplate: "test://{name}", Name: "test"}, func(ctx context.Context, uri string, vars map[string]string) ([]ResourceContents, error) {
+		return []ResourceContents{{URI: uri, Text: vars["name"]}}, nil
+	}, nil)
+	w := &fakeWatcher{changed: make(chan func(map[string]interface{}), 1), stopped: make(chan string, 1)}
+	s.SetResourceWatcher(w)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		s.Serve(inR, outW)
+		outW.Close()
+	}()
+	out := bufio.NewScanner(outR)
+	send := func(line string) string {
+		t.Helper()
+		fmt.Fprintln(inW, line)
+		if !out.Scan() {
+			t.Fatal("no response")
+		}
+		return out.Text()
+	}
+
+	if got := send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`); !strings.Contains(got, `"resources":{"subscribe":true}`) {
+		t.Errorf("initialize = %s", got)
+	}
+	if got := send(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"other://x"}}`); !strings.Contains(got, `"code":-32002`) {
+		t.Errorf("subscribe to unknown uri = %s", got)
+	}
+	if got := send(`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"test://a"}}`); got != `{"jsonrpc":"2.0","id":3,"result":{}}` {
+		t.Errorf("subscribe = %s", got)
+	}
+	changed := <-w.changed
+	go changed(map[string]interface{}{"size": 3})
+	if !out.Scan() || out.Text() != `{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"_meta":{"size":3},"uri":"test://a"}}` {
+		t.Errorf("notification = %s", out.Text())
+	}
+
+	inW.Close()
+	select {
+	case uri := <-w.stopped:
+		if uri != "test://a" {
+			t.Errorf("unwatched %s", uri)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("subscription not ended on shutdown")
+	}
+}
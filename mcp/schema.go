@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaFor returns the JSON schema describing T. Struct fields follow their
+// json tags; fields without omitempty are required. A `description` tag sets
+// the property description and an `enum` tag lists allowed values separated
+// by "|". A `format` tag sets the string format, and `minimum` and `maximum`
+// tags bound numbers.
+func SchemaFor[T any]() map[string]interface{} {
+	var zero T
+	t := reflect.TypeOf(&zero).Elem()
+	schema := schemaOf(t)
+	if schema["type"] != "object" {
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+	return schema
+}
+
+func schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaOf(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaOf(t.Elem()),
+		}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if embedded := embeddedStruct(f); embedded != nil {
+			// Fields of an untagged embedded struct are promoted, as
+			// encoding/json does.
+			schema := structSchema(embedded)
+			for name, prop := range schema["properties"].(map[string]interface{}) {
+				properties[name] = prop
+			}
+			if req, ok := schema["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, omitempty, skip := jsonField(f)
+		if skip {
+			continue
+		}
+		prop := schemaOf(f.Type)
+		if desc := f.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop["enum"] = strings.Split(enum, "|")
+		}
+		if format := f.Tag.Get("format"); format != "" {
+			prop["format"] = format
+		}
+		for _, bound := range []string{"minimum", "maximum"} {
+			if n, err := strconv.ParseFloat(f.Tag.Get(bound), 64); err == nil {
+				prop[bound] = n
+			}
+		}
+		properties[name] = prop
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func embeddedStruct(f reflect.StructField) reflect.Type {
+	if !f.Anonymous || f.Tag.Get("json") != "" {
+		return nil
+	}
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+func jsonField(f reflect.StructField) (name string, omitempty bool, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaFor(t *testing.T) {
+	type args struct {
+		Command string            `json:"command" description:"what to run"`
+		Mode    string            `json:"mode,omitempty" enum:"a|b"`
+		Hosts   []string          `json:"hosts,omitempty"`
+		Env     map[string]string `json:"env,omitempty"`
+		Limit   *int              `json:"limit,omitempty" minimum:"1" maximum:"100"`
+		Wait    string            `json:"wait,omitempty" format:"duration"`
+		hidden  string
+	}
+	schema := SchemaFor[args]()
+
+	if !reflect.DeepEqual(schema["required"], []string{"command"}) {
+		t.Errorf("required = %v", schema["required"])
+	}
+	props := schema["properties"].(map[string]interface{})
+	if len(props) != 6 {
+		t.Errorf("got %d properties, want 6", len(props))
+	}
+	command := props["command"].(map[string]interface{})
+	if command["type"] != "string" || command["description"] != "what to run" {
+		t.Errorf("command = %v", command)
+	}
+	if mode := props["mode"].(map[string]interface{}); !reflect.DeepEqual(mode["enum"], []string{"a", "b"}) {
+		t.Errorf("mode enum = %v", mode["enum"])
+	}
+	if hosts := props["hosts"].(map[string]interface{}); hosts["type"] != "array" {
+		t.Errorf("hosts = %v", hosts)
+	}
+	if limit := props["limit"].(map[string]interface{}); limit["type"] != "integer" || limit["minimum"] != 1.0 || limit["maximum"] != 100.0 {
+		t.Errorf("limit = %v", limit)
+	}
+	if wait := props["wait"].(map[string]interface{}); wait["format"] != "duration" {
+		t.Errorf("wait = %v", wait)
+	}
+}
+
+func TestSchemaForEmbedded(t *testing.T) {
+	type base struct {
+		Name string `json:"name"`
+		Port int    `json:"port,omitempty"`
+	}
+	type entry struct {
+		*base
+		Connected bool `json:"connected"`
+	}
+	schema := SchemaFor[entry]()
+	props := schema["properties"].(map[string]interface{})
+	if _, ok := props["name"]; !ok || len(props) != 3 {
+		t.Errorf("properties = %v", props)
+	}
+	if !reflect.DeepEqual(schema["required"], []string{"name", "connected"}) {
+		t.Errorf("required = %v", schema["required"])
+	}
+}
@@ -0,0 +1,570 @@
+// Package mcp implements a Model Context Protocol server over JSON-RPC 2.0
+// with a registry of tools.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ProtocolVersion is the latest protocol version the server speaks.
+const ProtocolVersion = "2025-06-18"
+
+// SupportedProtocolVersions lists the protocol versions the server can
+// negotiate, newest first.
+var SupportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+const maxMessageSize = 16 << 20
+
+// ErrClosed is returned for server-to-client requests that cannot complete
+// because the client went away.
+var ErrClosed = errors.New("mcp: connection closed")
+
+type methodHandler func(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError)
+
+type Server struct {
+	name    string
+	version string
+
+	mu         sync.Mutex
+	tools      map[string]ToolHandler
+	toolOrder  []Tool
+	methods    map[string]methodHandler
+	clientCaps map[string]json.RawMessage
+	// protocolVersion is the negotiated protocol version, empty until
+	// initialize.
+	protocolVersion string
+	// listedTools is the visible tool list last announced to the client.
+	listedTools string
+	filters     []ResultFilter
+
+	templates       []resourceTemplate
+	resourceFilters []ResourceFilter
+	watcher         ResourceWatcher
+	subscriptions   map[string]bool
+
+	prompts     map[string]PromptHandler
+	promptOrder []Prompt
+
+	// logLevel is the minimum level sent to the client; nil until
+	// LogHandler enables logging.
+	logLevel *atomic.Int64
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	pendingMu sync.Mutex
+	nextID    int64
+	pending   map[string]chan *jsonrpcMessage
+	closed    chan struct{}
+}
+
+// jsonrpcMessage is any incoming message: a request, a notification or a
+// response to a request sent by the server.
+type jsonrpcMessage struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+func NewServer(name, version string) *Server {
+	s := &Server{
+		name:    name,
+		version: version,
+		tools:   map[string]ToolHandler{},
+		pending: map[string]chan *jsonrpcMessage{},
+		closed:  make(chan struct{}),
+	}
+	s.methods = map[string]methodHandler{
+		"initialize": s.handleInitialize,
+		"ping":       s.handlePing,
+		"tools/list": s.handleListTools,
+		"tools/call": s.handleCallTool,
+
+		"resources/list":           s.handleListResources,
+		"resources/templates/list": s.handleListResourceTemplates,
+		"resources/read":           s.handleReadResource,
+		"resources/subscribe":      s.handleSubscribe,
+		"resources/unsubscribe":    s.handleUnsubscribe,
+
+		"prompts/list": s.handleListPrompts,
+		"prompts/get":  s.handleGetPrompt,
+
+		"logging/setLevel": s.handleSetLevel,
+	}
+	return s
+}
+
+// AddTool registers a tool with a handler receiving the raw arguments. Use
+// the generic AddTool function to get typed arguments and a generated schema.
+// Once the client is initialized it is told that the tool list changed.
+func (s *Server) AddTool(tool Tool, handler ToolHandler) {
+	s.mu.Lock()
+	if _, exists := s.tools[tool.Name]; exists {
+		for i := range s.toolOrder {
+			if s.toolOrder[i].Name == tool.Name {
+				s.toolOrder[i] = tool
+			}
+		}
+	} else {
+		s.toolOrder = append(s.toolOrder, tool)
+	}
+	s.tools[tool.Name] = handler
+	s.mu.Unlock()
+	s.ToolsChanged()
+}
+
+// HasTool reports whether a tool named name is registered.
+func (s *Server) HasTool(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tools[name]
+	return ok
+}
+
+// RemoveTool unregisters a tool and reports whether it existed.
+func (s *Server) RemoveTool(name string) bool {
+	s.mu.Lock()
+	_, ok := s.tools[name]
+	if ok {
+		delete(s.tools, name)
+		for i := range s.toolOrder {
+			if s.toolOrder[i].Name == name {
+				s.toolOrder = append(s.toolOrder[:i], s.toolOrder[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	if ok {
+		s.ToolsChanged()
+	}
+	return ok
+}
+
+// ToolsChanged sends notifications/tools/list_changed if the set of
+// available tools differs from the one last listed or announced. It does
+// nothing before the client is initialized.
+func (s *Server) ToolsChanged() {
+	if s.NegotiatedVersion() == "" {
+		return
+	}
+	names := toolNames(s.visibleTools())
+	s.mu.Lock()
+	changed := names != s.listedTools
+	s.listedTools = names
+	s.mu.Unlock()
+	if changed {
+		s.Notify("notifications/tools/list_changed", nil)
+	}
+}
+
+// visibleTools returns the registered tools that are available now. The
+// availability checks run without s.mu held.
+func (s *Server) visibleTools() []Tool {
+	s.mu.Lock()
+	all := make([]Tool, len(s.toolOrder))
+	copy(all, s.toolOrder)
+	s.mu.Unlock()
+	tools := []Tool{}
+	for _, t := range all {
+		if t.availability() == nil {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+func toolNames(tools []Tool) string {
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Name
+	}
+	return strings.Join(names, "\n")
+}
+
+// Serve reads newline-delimited JSON-RPC messages from r and writes
+// responses to w until r is exhausted. Requests are handled one at a time in
+// arrival order on a separate goroutine, so a handler can wait for the client
+// to answer a server request while messages keep being read.
+//
+// When r ends, the request being handled is cancelled, queued requests are
+// dropped and resource subscriptions end before Serve returns.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.writeMu.Lock()
+	s.out = w
+	s.writeMu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newRequestQueue()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			req, ok := q.pop()
+			if !ok || ctx.Err() != nil {
+				return
+			}
+			s.handleRequest(ctx, req)
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Method == "" && len(msg.Id) > 0:
+			s.deliver(&msg)
+		case msg.Method != "" && len(msg.Id) > 0:
+			q.push(&JSONRPCRequest{Jsonrpc: msg.Jsonrpc, Id: msg.Id, Method: msg.Method, Params: msg.Params})
+		}
+	}
+
+	close(s.closed)
+	cancel()
+	q.close()
+	<-done
+	s.unwatchAll()
+	return scanner.Err()
+}
+
+// requestQueue is an unbounded FIFO so that reading never blocks on a busy
+// handler.
+type requestQueue struct {
+	mu     sync.Mutex
+	items  []*JSONRPCRequest
+	closed bool
+	ready  chan struct{}
+}
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *requestQueue) push(req *JSONRPCRequest) {
+	q.mu.Lock()
+	q.items = append(q.items, req)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *requestQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *requestQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the next request, blocking until one arrives. It returns false
+// once the queue is closed and drained.
+func (q *requestQueue) pop() (*JSONRPCRequest, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			req := q.items[0]
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			return req, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-q.ready
+	}
+}
+
+func (s *Server) handleRequest(ctx context.Context, req *JSONRPCRequest) {
+	var result interface{}
+	var rpcErr *JSONRPCError
+	s.mu.Lock()
+	handler, ok := s.methods[req.Method]
+	initialized := s.protocolVersion != ""
+	s.mu.Unlock()
+	switch {
+	case !initialized && req.Method != "initialize" && req.Method != "ping":
+		rpcErr = &JSONRPCError{Code: CodeInvalidRequest, Message: "Server not initialized"}
+	case ok:
+		result, rpcErr = s.call(ctx, handler, req)
+	default:
+		rpcErr = &JSONRPCError{Code: CodeMethodNotFound, Message: "Method not found"}
+	}
+	s.write(JSONRPCResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  result,
+		Error:   rpcErr,
+	})
+}
+
+// call runs handler, turning a panic into an internal error so that one bad
+// handler does not take down the server.
+func (s *Server) call(ctx context.Context, handler methodHandler, req *JSONRPCRequest) (result interface{}, rpcErr *JSONRPCError) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = nil
+			rpcErr = &JSONRPCError{Code: CodeInternalError, Message: fmt.Sprintf("Internal error: %s panicked: %v", req.Method, v)}
+		}
+	}()
+	return handler(ctx, req.Params)
+}
+
+func (s *Server) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.out == nil {
+		return ErrClosed
+	}
+	_, err = fmt.Fprintln(s.out, string(data))
+	return err
+}
+
+// Notify sends a notification to the client, without params when params is
+// nil. It does nothing once the client has gone away.
+func (s *Server) Notify(method string, params interface{}) error {
+	select {
+	case <-s.closed:
+		return ErrClosed
+	default:
+	}
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	return s.write(msg)
+}
+
+// Request sends a request to the client and decodes its result into result.
+func (s *Server) Request(ctx context.Context, method string, params, result interface{}) error {
+	s.pendingMu.Lock()
+	s.nextID++
+	id := strconv.FormatInt(s.nextID, 10)
+	ch := make(chan *jsonrpcMessage, 1)
+	s.pending[id] = ch
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, id)
+		s.pendingMu.Unlock()
+	}()
+
+	err := s.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      json.RawMessage(id),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closed:
+		return ErrClosed
+	}
+}
+
+func (s *Server) deliver(msg *jsonrpcMessage) {
+	s.pendingMu.Lock()
+	ch, ok := s.pending[string(msg.Id)]
+	s.pendingMu.Unlock()
+	if ok {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// ClientSupports reports whether the client declared capability during
+// initialization.
+func (s *Server) ClientSupports(capability string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.clientCaps[capability]
+	return ok
+}
+
+// NegotiatedVersion returns the protocol version agreed in initialize, or
+// "" before it.
+func (s *Server) NegotiatedVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocolVersion
+}
+
+func (s *Server) handlePing(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	return map[string]interface{}{}, nil
+}
+
+type initializeParams struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+}
+
+func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p initializeParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+		}
+	}
+	version := ProtocolVersion
+	for _, v := range SupportedProtocolVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+	s.mu.Lock()
+	if s.protocolVersion != "" {
+		s.mu.Unlock()
+		return nil, &JSONRPCError{Code: CodeInvalidRequest, Message: "Server already initialized"}
+	}
+	s.clientCaps = p.Capabilities
+	s.protocolVersion = version
+	s.mu.Unlock()
+
+	capabilities := map[string]interface{}{
+		"tools": map[string]interface{}{"listChanged": true},
+	}
+	if s.hasResources() {
+		resources := map[string]interface{}{}
+		s.mu.Lock()
+		if s.watcher != nil {
+			resources["subscribe"] = true
+		}
+		s.mu.Unlock()
+		capabilities["resources"] = resources
+	}
+	if s.hasPrompts() {
+		capabilities["prompts"] = map[string]interface{}{}
+	}
+	if s.hasLogging() {
+		capabilities["logging"] = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    capabilities,
+		"serverInfo": map[string]interface{}{
+			"name":    s.name,
+			"version": s.version,
+		},
+	}, nil
+}
+
+// supports reports whether the negotiated protocol version is at least
+// version. Versions are dates, so they compare as strings.
+func (s *Server) supports(version string) bool {
+	return s.NegotiatedVersion() >= version
+}
+
+func (s *Server) handleListTools(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	outputs, annotations := s.supports("2025-06-18"), s.supports("2025-03-26")
+	tools := s.visibleTools()
+	s.mu.Lock()
+	s.listedTools = toolNames(tools)
+	s.mu.Unlock()
+	for i := range tools {
+		if !outputs {
+			tools[i].OutputSchema = nil
+		}
+		if !annotations {
+			tools[i].Annotations = nil
+		}
+	}
+	return ListToolsResult{Tools: tools}, nil
+}
+
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+func (s *Server) handleCallTool(ctx context.Context, params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p callToolParams
+	if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+		return nil, &JSONRPCError{Code: CodeInvalidParams, Message: "Invalid params"}
+	}
+	s.mu.Lock()
+	handler, ok := s.tools[p.Name]
+	var tool Tool
+	for _, t := range s.toolOrder {
+		if t.Name == p.Name {
+			tool = t
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, &JSONRPCError{Code: CodeMethodNotFound, Message: "Method not found"}
+	}
+	var result *CallToolResult
+	if err := tool.availability(); err != nil && (tool.allowUnavailable == nil || !tool.allowUnavailable(p.Arguments)) {
+		result = ErrorResult(fmt.Sprintf("%s is unavailable: %v", p.Name, err))
+	} else if result, err = handler(ctx, p.Arguments); err != nil {
+		result = ErrorResult(err.Error())
+	} else if result == nil {
+		return nil, &JSONRPCError{Code: CodeInternalError, Message: fmt.Sprintf("Internal error: tool %s returned no result", p.Name)}
+	}
+	s.mu.Lock()
+	filters := s.filters
+	s.mu.Unlock()
+	for _, f := range filters {
+		f(p.Name, result)
+	}
+	if !s.supports("2025-06-18") {
+		result.StructuredContent = nil
+	}
+	return result, nil
+}
+
+// ResultFilter rewrites a tool result before it is sent to the client.
+type ResultFilter func(tool string, result *CallToolResult)
+
+// AddResultFilter runs f on every tool result, in the order filters were
+// added.
+func (s *Server) AddResultFilter(f ResultFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, f)
+}
@@ -0,0 +1,236 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConn is a client end of a server started by startTestServer.
+type testConn struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Scanner
+	done chan struct{}
+	once sync.Once
+}
+
+func startTestServer(t *testing.T, s *Server) *testConn {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testConn{t: t, in: inW, out: bufio.NewScanner(outR), done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		s.Serve(inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(c.close)
+	return c
+}
+
+// send writes one request line and returns the next line from the server.
+func (c *testConn) send(line string) string {
+	c.t.Helper()
+	fmt.Fprintln(c.in, line)
+	if !c.out.Scan() {
+		c.t.Fatal("no response")
+	}
+	return c.out.Text()
+}
+
+// close ends the input and discards further output.
+func (c *testConn) close() {
+	c.once.Do(func() {
+		c.in.Close()
+		go func() {
+			for c.out.Scan() {
+			}
+		}()
+	})
+}
+
+func TestInitializeNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		requested, want string
+	}{
+		{"2024-11-05", "2024-11-05"},
+		{"2025-03-26", "2025-03-26"},
+		{"2025-06-18", "2025-06-18"},
+		{"2099-01-01", ProtocolVersion},
+		{"", ProtocolVersion},
+	} {
+		s := NewServer("test", "0")
+		got := startTestServer(t, s).send(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":%q,"capabilities":{"sampling":{}}}}`, tc.requested))
+		var resp struct {
+			Result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			} `json:"result"`
+		}
+		json.Unmarshal([]byte(got), &resp)
+		if resp.Result.ProtocolVersion != tc.want {
+			t.Errorf("requested %q: got %s, want %s", tc.requested, got, tc.want)
+		}
+		if s.NegotiatedVersion() != tc.want {
+			t.Errorf("requested %q: NegotiatedVersion = %q", tc.requested, s.NegotiatedVersion())
+		}
+		if !s.ClientSupports("sampling") || s.ClientSupports("elicitation") {
+			t.Errorf("requested %q: client capabilities not stored", tc.requested)
+		}
+	}
+}
+
+func TestRequestsBeforeInitialize(t *testing.T) {
+	s := NewServer("test", "0")
+	c := startTestServer(t, s)
+
+	if got := c.send(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); !strings.Contains(got, `"code":-32600`) {
+		t.Errorf("tools/list before initialize = %s", got)
+	}
+	if got := c.send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`); got != `{"jsonrpc":"2.0","id":2,"result":{}}` {
+		t.Errorf("ping = %s", got)
+	}
+	c.send(`{"jsonrpc":"2.0","id":3,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if got := c.send(`{"jsonrpc":"2.0","id":4,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`); !strings.Contains(got, `"code":-32600`) {
+		t.Errorf("second initialize = %s", got)
+	}
+	if got := c.send(`{"jsonrpc":"2.0","id":5,"method":"tools/list"}`); !strings.Contains(got, `"result":{"tools":[]}`) {
+		t.Errorf("tools/list = %s", got)
+	}
+}
+
+func TestServeCancelsOnEOF(t *testing.T) {
+	s := NewServer("test", "0")
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	calls := 0
+	s.AddTool(Tool{Name: "wait"}, func(ctx context.Context, args json.RawMessage) (*CallToolResult, error) {
+		calls++
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return &CallToolResult{}, nil
+	})
+	c := startTestServer(t, s)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	fmt.Fprintln(c.in, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"wait"}}`)
+	fmt.Fprintln(c.in, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"wait"}}`)
+	<-started
+	c.close()
+
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after EOF")
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("running handler was not cancelled")
+	}
+	if calls != 1 {
+		t.Errorf("queued request ran after EOF: %d calls", calls)
+	}
+}
+
+func TestStructuredOutputGatedByVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version              string
+		outputs, annotations bool
+	}{
+		{"2024-11-05", false, false},
+		{"2025-03-26", false, true},
+		{"2025-06-18", true, true},
+	} {
+		s := NewServer("test", "0")
+		type out struct {
+			N int `json:"n"`
+		}
+		AddTool(s, "count", "Count", func(ctx context.Context, args struct{}) (*CallToolResult, error) {
+			return StructuredResult("1", out{N: 1}), nil
+		}, WithOutput[out](), WithAnnotations(ToolAnnotations{ReadOnlyHint: Bool(true)}))
+		c := startTestServer(t, s)
+		c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":%q}}`, tc.version))
+
+		list := c.send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		if got := strings.Contains(list, `"outputSchema":{"properties":{"n":{"type":"integer"}}`); got != tc.outputs {
+			t.Errorf("%s: tools/list = %s", tc.version, list)
+		}
+		if got := strings.Contains(list, `"annotations":{"readOnlyHint":true}`); got != tc.annotations {
+			t.Errorf("%s: tools/list = %s", tc.version, list)
+		}
+		call := c.send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"count"}}`)
+		if got := strings.Contains(call, `"structuredContent":{"n":1}`); got != tc.outputs {
+			t.Errorf("%s: tools/call = %s", tc.version, call)
+		}
+	}
+}
+
+func TestToolHandlerFailures(t *testing.T) {
+	s := NewServer("test", "0")
+	AddTool(s, "nothing", "Returns no result", func(ctx context.Context, args struct{}) (*CallToolResult, error) {
+		return nil, nil
+	})
+	AddTool(s, "crash", "Panics", func(ctx context.Context, args struct{}) (*CallToolResult, error) {
+		panic("boom")
+	})
+	c := startTestServer(t, s)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+
+	for i, tc := range []struct{ tool, want string }{
+		{"nothing", `"error":{"code":-32603,"message":"Internal error: tool nothing returned no result"}`},
+		{"crash", `"error":{"code":-32603,"message":"Internal error: tools/call panicked: boom"}`},
+	} {
+		resp := c.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q}}`, i+2, tc.tool))
+		if !strings.Contains(resp, tc.want) {
+			t.Errorf("%s: %s", tc.tool, resp)
+		}
+	}
+	// The server keeps serving.
+	if resp := c.send(`{"jsonrpc":"2.0","id":4,"method":"ping"}`); !strings.Contains(resp, `"result":{}`) {
+		t.Errorf("ping after panic = %s", resp)
+	}
+}
+
+func TestToolListChanged(t *testing.T) {
+	s := NewServer("test", "0")
+	var connected atomic.Bool
+	AddTool(s, "run", "Run", func(ctx context.Context, args struct{}) (*CallToolResult, error) {
+		return TextResult("ran"), nil
+	}, WithAvailability(func() error {
+		if !connected.Load() {
+			return errors.New("not connected")
+		}
+		return nil
+	}))
+	c := startTestServer(t, s)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+
+	if got := c.send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); got != `{"jsonrpc":"2.0","id":2,"result":{"tools":[]}}` {
+		t.Errorf("tools/list = %s", got)
+	}
+	if got := c.send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"run"}}`); !strings.Contains(got, `run is unavailable: not connected`) {
+		t.Errorf("tools/call = %s", got)
+	}
+
+	const changed = `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`
+	connected.Store(true)
+	go s.ToolsChanged()
+	if !c.out.Scan() || c.out.Text() != changed {
+		t.Errorf("notification = %s", c.out.Text())
+	}
+	// Nothing changed since the last announcement.
+	s.ToolsChanged()
+	go s.RemoveTool("run")
+	if !c.out.Scan() || c.out.Text() != changed {
+		t.Errorf("notification after RemoveTool = %s", c.out.Text())
+	}
+}
@@ -0,0 +1,160 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	// OutputSchema describes the structuredContent of the tool's results.
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations       `json:"annotations,omitempty"`
+
+	// available reports why the tool cannot be used right now, or nil.
+	available func() error
+	// allowUnavailable accepts calls made while the tool is unavailable.
+	allowUnavailable func(args json.RawMessage) bool
+}
+
+// ToolAnnotations are hints about a tool's behavior. Unset hints take the
+// protocol defaults: not read-only, destructive, not idempotent and open
+// world.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+// Bool returns a pointer to b, for setting annotation hints.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// ToolOption sets optional parts of a tool registered with AddTool.
+type ToolOption func(*Tool)
+
+// WithOutput declares the output schema generated from O. Results of the
+// tool should set StructuredContent to an O.
+func WithOutput[O any]() ToolOption {
+	return WithOutputSchema(SchemaFor[O]())
+}
+
+// WithOutputSchema declares an output schema for the tool.
+func WithOutputSchema(schema map[string]interface{}) ToolOption {
+	return func(t *Tool) { t.OutputSchema = schema }
+}
+
+// WithAnnotations sets the tool's annotations.
+func WithAnnotations(a ToolAnnotations) ToolOption {
+	return func(t *Tool) { t.Annotations = &a }
+}
+
+// WithAvailability hides the tool from tools/list while check returns an
+// error, and fails calls to it with that error. Call Server.ToolsChanged
+// when the outcome of check may have changed.
+func WithAvailability(check func() error) ToolOption {
+	return func(t *Tool) { t.available = check }
+}
+
+// WithUnavailableCalls runs calls whose arguments allow accepts even while
+// the tool is unavailable, such as dry runs that need no connection. The
+// tool stays hidden from tools/list.
+func WithUnavailableCalls(allow func(args json.RawMessage) bool) ToolOption {
+	return func(t *Tool) { t.allowUnavailable = allow }
+}
+
+// availability returns nil if t can be used now.
+func (t *Tool) availability() error {
+	if t.available == nil {
+		return nil
+	}
+	return t.available()
+}
+
+type ListToolsResult struct {
+	Tools []Tool `json:"tools"`
+}
+
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	// StructuredContent is the result as described by the tool's output
+	// schema, sent next to the text content.
+	StructuredContent interface{}            `json:"structuredContent,omitempty"`
+	IsError           bool                   `json:"isError,omitempty"`
+	Meta              map[string]interface{} `json:"_meta,omitempty"`
+}
+
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// TextResult returns a successful result holding a single text block.
+func TextResult(text string) *CallToolResult {
+	return &CallToolResult{
+		Content: []Content{{Type: "text", Text: text}},
+	}
+}
+
+// ErrorResult returns a failed result holding a single text block.
+func ErrorResult(text string) *CallToolResult {
+	return &CallToolResult{
+		Content: []Content{{Type: "text", Text: text}},
+		IsError: true,
+	}
+}
+
+// StructuredResult returns a successful result holding a text block and v
+// as structured content.
+func StructuredResult(text string, v interface{}) *CallToolResult {
+	res := TextResult(text)
+	res.StructuredContent = v
+	return res
+}
+
+// ToolHandler handles a tools/call request with the raw arguments object.
+type ToolHandler func(ctx context.Context, args json.RawMessage) (*CallToolResult, error)
+
+// AddTool registers a tool whose arguments are decoded into T. The input
+// schema is generated from T. Errors returned by handler are reported to the
+// client as a failed tool result.
+func AddTool[T any](s *Server, name, description string, handler func(ctx context.Context, args T) (*CallToolResult, error), opts ...ToolOption) {
+	schema := SchemaFor[T]()
+	tool := Tool{Name: name, Description: description, InputSchema: schema}
+	for _, opt := range opts {
+		opt(&tool)
+	}
+	s.AddTool(tool, func(ctx context.Context, raw json.RawMessage) (*CallToolResult, error) {
+		var args T
+		if len(raw) > 0 && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+			}
+		}
+		if missing := missingRequired(schema, raw); missing != "" {
+			return ErrorResult(fmt.Sprintf("%s parameter required", missing)), nil
+		}
+		return handler(ctx, args)
+	})
+}
+
+func missingRequired(schema map[string]interface{}, raw json.RawMessage) string {
+	required, _ := schema["required"].([]string)
+	if len(required) == 0 {
+		return ""
+	}
+	var present map[string]json.RawMessage
+	json.Unmarshal(raw, &present)
+	for _, name := range required {
+		if v, ok := present[name]; !ok || string(v) == "null" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+// Package policy classifies commands by risk.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"ssh-executor/shell"
+)
+
+type Action string
+
+const (
+	// Confirm requires a human to approve the command before it runs.
+	Confirm Action = "confirm"
+	// Deny refuses the command outright.
+	Deny Action = "deny"
+)
+
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  Action
+	Reason  string
+}
+
+type Policy struct {
+	Rules []Rule
+}
+
+// word anchors a pattern at the start of a command: the start of a line, a
+// shell separator or a reserved word that starts a command, optionally
+// behind sudo and its options, such as -u <user>, and a directory prefix
+// such as /usr/bin/.
+const word = `(?m:^|[;&|(\x60{!]|\$\(|\b(?:then|do|else)\s)\s*(?:sudo\s+(?:-\S+\s+(?:[\w.-]+\s+)?)*)?(?:[\w.-]*/)*`
+
+var builtinRules = []struct {
+	name, pattern, reason string
+	action                Action
+}{
+	{"root-wipe", word + `rm\s+(?:-\S*\s+)*-\S*[rR]\S*\s+(?:-\S+\s+)*/(?:\s|$|\*)`, "recursive delete of /", Deny},
+	{"fork-bomb", `:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, "fork bomb", Deny},
+	{"service-change", word + `(?:systemctl\s+(?:\S+\s+)*(?:restart|stop|reload|kill|disable|mask|isolate)|service\s+\S+\s+(?:restart|stop|reload))\b`, "changes the state of a service", Confirm},
+	{"package-change", word + `(?:apt(?:-get)?\s+(?:\S+\s+)*(?:upgrade|dist-upgrade|full-upgrade|install|remove|purge|autoremove)|(?:yum|dnf)\s+(?:\S+\s+)*(?:update|upgrade|install|remove|erase|downgrade)|apk\s+(?:add|del|upgrade)|zypper\s+(?:in|install|up|update|rm|remove|dup)|pacman\s+-S|snap\s+(?:install|remove|refresh))\b`, "installs, upgrades or removes packages", Confirm},
+	{"power", word + `(?:reboot|shutdown|poweroff|halt|init\s+[06])\b`, "reboots or powers off the host", Confirm},
+	{"recursive-delete", word + `rm\s+(?:\S+\s+)*-\S*[rR]`, "recursive delete", Confirm},
+	{"filesystem", word + `(?:mkfs(?:\.\w+)?|fdisk|parted|wipefs|dd\s+.*\bof=)`, "writes to block devices or filesystems", Confirm},
+	{"process-kill", word + `(?:kill\s+-(?:9|KILL|SIGKILL)|killall|pkill)\b`, "kills processes", Confirm},
+	{"firewall", word + `(?:iptables|ip6tables|nft|ufw|firewall-cmd)\b`, "changes firewall rules", Confirm},
+	{"user-change", word + `(?:useradd|userdel|usermod|passwd|groupdel|chpasswd)\b`, "changes user accounts", Confirm},
+	{"container-change", word + `(?:docker|podman)\s+(?:rm|rmi|stop|restart|kill|prune|system\s+prune)\b`, "stops or removes containers", Confirm},
+	{"kubernetes-change", word + `kubectl\s+(?:\S+\s+)*(?:delete|apply|drain|cordon|scale|rollout\s+restart|replace|patch)\b`, "changes cluster state", Confirm},
+}
+
+// Default returns the built-in rules.
+func Default() *Policy {
+	p := &Policy{}
+	for _, r := range builtinRules {
+		p.Rules = append(p.Rules, Rule{
+			Name:    r.name,
+			Pattern: regexp.MustCompile(r.pattern),
+			Action:  r.action,
+			Reason:  r.reason,
+		})
+	}
+	return p
+}
+
+// Check returns the rule that applies to cmd, or nil if the command may run
+// without approval. Deny rules win over confirm rules. Rules are matched
+// against the whole text and against each simple command in it, so that
+// commands inside compound commands and scripts are checked too.
+func (p *Policy) Check(cmd string) *Rule {
+	if p == nil {
+		return nil
+	}
+	texts := append([]string{cmd}, commands(cmd)...)
+	var match *Rule
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !matchAny(r.Pattern, texts) {
+			continue
+		}
+		if r.Action == Deny {
+			return r
+		}
+		if match == nil {
+			match = r
+		}
+	}
+	return match
+}
+
+// commands returns each simple command of cmd as a line of its program name,
+// without directory, and its arguments. Reserved words such as then and do
+// are left out. It returns nothing if cmd does not parse.
+func commands(cmd string) []string {
+	parsed, err := shell.Parse(cmd)
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, c := range parsed {
+		if c.Program == "" {
+			continue
+		}
+		words := append([]string{path.Base(c.Program)}, c.Args...)
+		lines = append(lines, strings.Join(words, " "))
+	}
+	return lines
+}
+
+func matchAny(re *regexp.Regexp, texts []string) bool {
+	for _, text := range texts {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+type fileRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Action  Action `yaml:"action"`
+	Reason  string `yaml:"reason"`
+}
+
+type file struct {
+	DisableBuiltin bool       `yaml:"disable_builtin"`
+	Rules          []fileRule `yaml:"rules"`
+}
+
+// Load reads rules from a YAML file and adds them to the built-in rules
+// unless the file sets disable_builtin.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rules := make([]Rule, 0, len(f.Rules))
+	for i, fr := range f.Rules {
+		r, err := NewRule(fr.Name, fr.Pattern, fr.Action, fr.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+		rules = append(rules, r)
+	}
+	p := &Policy{}
+	if !f.DisableBuiltin {
+		p = Default()
+	}
+	p.Rules = append(rules, p.Rules...)
+	return p, nil
+}
+
+// NewRule compiles a rule. Action defaults to Confirm.
+func NewRule(name, pattern string, action Action, reason string) (Rule, error) {
+	if action == "" {
+		action = Confirm
+	}
+	if action != Confirm && action != Deny {
+		return Rule{}, fmt.Errorf("unknown action %q", action)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, err
+	}
+	if name == "" {
+		name = pattern
+	}
+	return Rule{Name: name, Pattern: re, Action: action, Reason: reason}, nil
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultRules(t *testing.T) {
+	p := Default()
+	for cmd, want := range map[string]string{
+		"uptime":                           "",
+		"systemctl status nginx":           "",
+		"ls -la /var/log":                  "",
+		"rm old.log":                       "",
+		"cat /etc/apt/sources.list":        "",
+		"sudo systemctl restart nginx":     "service-change",
+		"sudo -u postgres pkill psql":      "process-kill",
+		"service postgresql stop":          "service-change",
+		"apt-get -y upgrade":               "package-change",
+		"cd /tmp && sudo -E yum install x": "package-change",
+		"reboot":                           "power",
+		"rm -rf build/":                    "recursive-delete",
+		"rm -rf /":                         "root-wipe",
+		"sudo rm -fr / --no-preserve-root": "root-wipe",
+		"kubectl -n prod delete pod web-1": "kubernetes-change",
+		"dd if=/dev/zero of=/dev/sda":      "filesystem",
+		"pkill -f worker":                  "process-kill",
+
+		"echo hi\nsystemctl restart nginx":           "service-change",
+		"if true; then systemctl restart x; fi":      "service-change",
+		"for i in 1 2; do reboot; done":              "power",
+		"test -f x || { rm -rf /; }":                 "root-wipe",
+		"! kill -9 1":                                "process-kill",
+		"/bin/systemctl restart x":                   "service-change",
+		"sudo /usr/sbin/reboot":                      "power",
+		"echo $(FOO=1 /usr/bin/apt-get install vim)": "package-change",
+		"if ls; then\n  echo ok\nelse\n  reboot\nfi": "power",
+		"cat /etc/reboot.conf\necho do not reboot":   "",
+	} {
+		rule := p.Check(cmd)
+		got := ""
+		if rule != nil {
+			got = rule.Name
+		}
+		if got != want {
+			t.Errorf("Check(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(path, []byte(`
+rules:
+  - name: no-prod-db
+    pattern: 'psql .*prod'
+    action: deny
+    reason: production database
+  - pattern: 'nginx -s reload'
+`), 0600)
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := p.Check("psql -h prod-db"); r == nil || r.Action != Deny || r.Name != "no-prod-db" {
+		t.Errorf("psql rule = %+v", r)
+	}
+	if r := p.Check("nginx -s reload"); r == nil || r.Action != Confirm {
+		t.Errorf("nginx rule = %+v", r)
+	}
+	if r := p.Check("reboot"); r == nil {
+		t.Error("built-in rules dropped")
+	}
+
+	os.WriteFile(path, []byte("rules:\n  - pattern: x\n    action: maybe\n"), 0600)
+	if _, err := Load(path); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
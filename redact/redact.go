@@ -0,0 +1,206 @@
+// Package redact removes credentials from text before it leaves the server.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Detector finds one kind of secret. If Pattern has a group named "secret",
+// only that group is replaced; otherwise the whole match is. Check, when
+// set, must also accept the secret for it to be redacted.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Check   func(secret string) bool
+}
+
+type Redactor struct {
+	Detectors []Detector
+}
+
+// assignment matches the value of key=value and key: value pairs, bare or
+// quoted, including quotes escaped inside JSON strings.
+const assignment = `\s*[=:]\s*(?P<secret>\\"(?:[^"\\\n]|\\[^"])*\\"|"[^"\n]*"|'[^'\n]*'|[^\s"'\\,;&]+)`
+
+var builtinDetectors = []struct {
+	name, pattern string
+	check         func(string) bool
+}{
+	{"private-key", `-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----`, nil},
+	{"aws-access-key", `\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`, nil},
+	{"aws-secret-key", `(?i)aws_?secret_?access_?key` + assignment, nil},
+	{"jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`, nil},
+	{"github-token", `\bgh[pousr]_[A-Za-z0-9]{36,}\b`, nil},
+	{"slack-token", `\bxox[abposr]-[A-Za-z0-9-]{10,}`, nil},
+	{"bearer-token", `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/=-]{16,})`, nil},
+	{"password", `(?i)\b[\w.-]*(?:password|passwd|passphrase|secret|token|api[_-]?key|access[_-]?key)` + assignment, nil},
+	{"url-credentials", `[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@"'\\]+:(?P<secret>[^\s@/"'\\]+)@`, nil},
+	{"high-entropy", `[A-Za-z0-9+/_=-]{32,}`, highEntropy},
+}
+
+// Default returns a Redactor with the built-in detectors.
+func Default() *Redactor {
+	r := &Redactor{}
+	for _, d := range builtinDetectors {
+		r.Detectors = append(r.Detectors, Detector{
+			Name:    d.name,
+			Pattern: regexp.MustCompile(d.pattern),
+			Check:   d.check,
+		})
+	}
+	return r
+}
+
+// Reloadable redacts with a Redactor that can be replaced while in use.
+type Reloadable struct {
+	current atomic.Pointer[Redactor]
+}
+
+func NewReloadable(r *Redactor) *Reloadable {
+	rl := &Reloadable{}
+	rl.Store(r)
+	return rl
+}
+
+// Store makes r the Redactor used from now on.
+func (rl *Reloadable) Store(r *Redactor) {
+	rl.current.Store(r)
+}
+
+func (rl *Reloadable) Redact(text string) (string, int) {
+	return rl.current.Load().Redact(text)
+}
+
+// Redact replaces the secrets found in text with [REDACTED:<detector>] and
+// returns the new text with the number of replacements.
+func (r *Redactor) Redact(text string) (string, int) {
+	if r == nil {
+		return text, 0
+	}
+	count := 0
+	for _, d := range r.Detectors {
+		secret := d.Pattern.SubexpIndex("secret")
+		text = replaceAll(d.Pattern, text, func(m []int) (int, int, bool) {
+			start, end := m[0], m[1]
+			if secret > 0 && m[2*secret] >= 0 {
+				start, end = m[2*secret], m[2*secret+1]
+			}
+			value := text[start:end]
+			if strings.Contains(value, "[REDACTED") || d.Check != nil && !d.Check(value) {
+				return 0, 0, false
+			}
+			count++
+			return start, end, true
+		}, "[REDACTED:"+d.Name+"]")
+	}
+	return text, count
+}
+
+// replaceAll replaces the span chosen by pick in each match of re.
+func replaceAll(re *regexp.Regexp, text string, pick func(m []int) (int, int, bool), repl string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end, ok := pick(m)
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(repl)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// highEntropy accepts random-looking tokens: a mix of letters and digits with
+// more than 4 bits of entropy per character, which rules out hex digests,
+// words and absolute paths.
+func highEntropy(s string) bool {
+	if strings.HasPrefix(s, "/") {
+		return false
+	}
+	var lower, upper, digit bool
+	freq := map[rune]float64{}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		freq[c]++
+	}
+	if !digit || !(lower && upper) {
+		return false
+	}
+	var entropy float64
+	n := float64(len(s))
+	for _, f := range freq {
+		p := f / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy > 4.0
+}
+
+type filePattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+type file struct {
+	DisableBuiltin bool          `yaml:"disable_builtin"`
+	Disable        []string      `yaml:"disable"`
+	Patterns       []filePattern `yaml:"patterns"`
+}
+
+// Load reads custom patterns from a YAML file and adds them to the built-in
+// detectors, minus those named in disable or all of them if the file sets
+// disable_builtin.
+func Load(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r := &Redactor{}
+	if !f.DisableBuiltin {
+		disabled := map[string]bool{}
+		for _, name := range f.Disable {
+			disabled[name] = true
+		}
+		for _, d := range Default().Detectors {
+			if !disabled[d.Name] {
+				r.Detectors = append(r.Detectors, d)
+			}
+		}
+	}
+	for i, fp := range f.Patterns {
+		re, err := regexp.Compile(fp.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %d: %w", path, i+1, err)
+		}
+		name := fp.Name
+		if name == "" {
+			name = "custom"
+		}
+		r.Detectors = append(r.Detectors, Detector{Name: name, Pattern: re})
+	}
+	return r, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"ssh-executor/config"
+	"ssh-executor/mcp"
+	"ssh-executor/redact"
+	"ssh-executor/tools"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+var configPollInterval = 2 * time.Second
+
+// reloader applies the config to the running server and reloads it on
+// SIGHUP or when the config file changes. Open connections are kept.
+type reloader struct {
+	// file is the config file, or "" when the settings come from the
+	// environment only.
+	file     string
+	server   *mcp.Server
+	targets  *tools.Targets
+	guard    *tools.Guard
+	redactor *redact.Reloadable
+	level    *slog.LevelVar
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	cfg       *config.File
+	loadedAt  time.Time
+	hostTools []string
+}
+
+// apply puts the settings of cfg into effect.
+func (r *reloader) apply(cfg *config.File, st *settings) {
+	base := st.base
+	base.KeyboardInteractive.Prompt = tools.ElicitPrompter(r.server)
+	base.Logger = r.logger
+	r.targets.Reconfigure(func(t *tools.Targets) {
+		t.Inventory = st.inventory
+		t.Groups = st.groups
+		t.Base = base
+		t.SudoPassword = st.sudoPassword
+		t.MaxOutputBytes = st.maxOutputBytes
+		t.Concurrency = st.concurrency
+		t.ConnectTimeout = st.connectTimeout
+		t.CommandTimeout = st.commandTimeout
+	})
+	r.guard.SetPolicy(st.policy)
+	r.redactor.Store(st.redactor)
+	r.level.Set(st.level)
+
+	r.mu.Lock()
+	r.cfg = cfg
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+}
+
+// reload reads the config again and applies it. A config that fails to load
+// leaves the current settings in place.
+func (r *reloader) reload() {
+	log := r.logger.With("logger", "config")
+	cfg, err := loadConfig()
+	if err == nil {
+		err = r.reapply(cfg, log)
+	}
+	if err != nil {
+		log.Error("config reload failed; keeping the current settings", "error", err)
+		return
+	}
+	log.Info("config reloaded")
+}
+
+func (r *reloader) reapply(cfg *config.File, log *slog.Logger) error {
+	st, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	old, oldTools := r.cfg, r.hostTools
+	r.mu.Unlock()
+
+	// These settings are only read at startup.
+	for _, setting := range []struct {
+		key      string
+		old, new *string
+	}{
+		{"transport", &old.Transport, &cfg.Transport},
+		{"logging.file", &old.Logging.File, &cfg.Logging.File},
+		{"audit.file", &old.Audit.File, &cfg.Audit.File},
+		{"prompts_dir", &old.PromptsDir, &cfg.PromptsDir},
+	} {
+		if *setting.new != *setting.old {
+			log.Warn("setting changed; restart the server to apply it", "setting", setting.key)
+			*setting.new = *setting.old
+		}
+	}
+
+	removed := map[string]bool{}
+	for _, name := range oldTools {
+		removed[name] = true
+	}
+	for _, h := range st.inventory.Hosts() {
+		for _, tool := range h.Tools {
+			if r.server.HasTool(tool.Name) && !removed[tool.Name] {
+				return fmt.Errorf("host %s: tool %q is already registered", h.Name, tool.Name)
+			}
+		}
+	}
+
+	r.apply(cfg, st)
+	for _, name := range oldTools {
+		r.server.RemoveTool(name)
+	}
+	names, err := tools.RegisterHostTools(r.server, r.targets, r.guard)
+	r.mu.Lock()
+	r.hostTools = names
+	r.mu.Unlock()
+	r.server.ToolsChanged()
+	return err
+}
+
+// current returns the settings in effect for get_server_config.
+func (r *reloader) current() tools.ServerConfig {
+	source := r.file
+	if source == "" {
+		source = "environment"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return tools.ServerConfig{
+		Source:   source,
+		LoadedAt: r.loadedAt.UTC().Format(time.RFC3339),
+		Config:   *r.cfg.Redacted(),
+	}
+}
+
+// watch reloads the config on SIGHUP and when the config file's size or
+// modification time changes, until ctx is done.
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := statConfig(r.file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			last = statConfig(r.file)
+			r.reload()
+		case <-ticker.C:
+			if r.file == "" {
+				continue
+			}
+			if now := statConfig(r.file); now != last {
+				last = now
+				r.reload()
+			}
+		}
+	}
+}
+
+type configState struct {
+	size  int64
+	mtime time.Time
+}
+
+func statConfig(path string) configState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return configState{}
+	}
+	return configState{size: info.Size(), mtime: info.ModTime()}
+}
@@ -0,0 +1,403 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Command is one simple command of a command line.
+type Command struct {
+	// Program is the command name, empty for a bare assignment or
+	// redirection.
+	Program string   `json:"program,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// Assignments are the NAME=value words preceding the program.
+	Assignments []string   `json:"assignments,omitempty"`
+	Redirects   []Redirect `json:"redirects,omitempty"`
+	// Operator joins this command to the next one: "|", "&&", "||", ";",
+	// "&" or "" for the last command unless it runs in the background.
+	Operator string `json:"operator,omitempty"`
+	// Nested is set for commands found inside $(...) or backticks.
+	Nested bool `json:"nested,omitempty"`
+}
+
+type Redirect struct {
+	Fd     string `json:"fd,omitempty"`
+	Op     string `json:"op"`
+	Target string `json:"target"`
+}
+
+// Parse splits a POSIX shell command line into simple commands. It
+// understands quoting, escapes, pipelines and lists, redirections, here
+// documents and command substitution, which is enough to describe what a
+// command line will do; it does not expand variables or globs.
+func Parse(line string) ([]Command, error) {
+	p := &parser{src: line}
+	if err := p.parse(false); err != nil {
+		return nil, err
+	}
+	return p.cmds, nil
+}
+
+type parser struct {
+	src    string
+	pos    int
+	cmds   []Command
+	cur    *Command
+	nested bool
+
+	heredocs []string
+}
+
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"do": true, "done": true, "while": true, "until": true, "for": true,
+	"case": true, "esac": true, "in": true, "!": true, "{": true, "}": true,
+}
+
+func (p *parser) parse(nested bool) error {
+	p.nested = nested
+	for {
+		p.skipBlanks()
+		if p.pos >= len(p.src) {
+			break
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '#' && p.atWordStart():
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '\n':
+			p.pos++
+			p.endCommand(";")
+			if err := p.skipHeredocs(); err != nil {
+				return err
+			}
+		case p.isRedirectStart():
+			if err := p.readRedirect(); err != nil {
+				return err
+			}
+		case c == ';' || c == '&' || c == '|':
+			p.endCommand(p.readOperator())
+		case c == '(' || c == ')':
+			p.pos++
+			p.endCommand(";")
+		default:
+			start := p.pos
+			word, err := p.readWord()
+			if err != nil {
+				return err
+			}
+			p.addWord(word, p.src[start:p.pos])
+		}
+	}
+	p.endCommand("")
+	if n := len(p.cmds); n > 0 && p.cmds[n-1].Operator != "&" {
+		p.cmds[n-1].Operator = ""
+	}
+	return nil
+}
+
+func (p *parser) atWordStart() bool {
+	return p.pos == 0 || strings.ContainsRune(" \t\n;&|()", rune(p.src[p.pos-1]))
+}
+
+func (p *parser) skipBlanks() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '\\':
+			if p.pos+1 < len(p.src) && p.src[p.pos+1] == '\n' {
+				p.pos += 2
+				continue
+			}
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) readOperator() string {
+	for _, op := range []string{"&&", "||", "|&", ";;", "|", "&", ";"} {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			p.pos += len(op)
+			if op == "|&" {
+				return "|"
+			}
+			if op == ";;" {
+				return ";"
+			}
+			return op
+		}
+	}
+	p.pos++
+	return ";"
+}
+
+func (p *parser) command() *Command {
+	if p.cur == nil {
+		p.cur = &Command{Nested: p.nested}
+	}
+	return p.cur
+}
+
+func (p *parser) endCommand(op string) {
+	if p.cur == nil {
+		return
+	}
+	p.cur.Operator = op
+	p.cmds = append(p.cmds, *p.cur)
+	p.cur = nil
+}
+
+// addWord adds word to the current command. Reserved words and assignments
+// are recognised on the raw text only, so quoting them makes them plain words.
+func (p *parser) addWord(word, raw string) {
+	cmd := p.command()
+	if cmd.Program == "" {
+		if reservedWords[raw] && len(cmd.Assignments) == 0 && len(cmd.Redirects) == 0 {
+			p.cur = nil
+			return
+		}
+		if isAssignment(raw) {
+			cmd.Assignments = append(cmd.Assignments, word)
+			return
+		}
+		cmd.Program = word
+		return
+	}
+	cmd.Args = append(cmd.Args, word)
+}
+
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) isRedirectStart() bool {
+	i := p.pos
+	for i < len(p.src) && p.src[i] >= '0' && p.src[i] <= '9' {
+		i++
+	}
+	if i >= len(p.src) {
+		return false
+	}
+	if i > p.pos && !p.atWordStart() {
+		return false
+	}
+	c := p.src[i]
+	if c == '<' || c == '>' {
+		return true
+	}
+	return i == p.pos && c == '&' && i+1 < len(p.src) && p.src[i+1] == '>'
+}
+
+var redirectOps = []string{"&>>", "<<<", "<<-", "&>", ">>", "<<", ">&", "<&", ">|", "<>", ">", "<"}
+
+func (p *parser) readRedirect() error {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	fd := p.src[start:p.pos]
+	var op string
+	for _, o := range redirectOps {
+		if strings.HasPrefix(p.src[p.pos:], o) {
+			op = o
+			break
+		}
+	}
+	p.pos += len(op)
+	p.skipBlanks()
+	target, err := p.readWord()
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("redirection %s%s without a target", fd, op)
+	}
+	if op == "<<" || op == "<<-" {
+		p.heredocs = append(p.heredocs, target)
+	}
+	cmd := p.command()
+	cmd.Redirects = append(cmd.Redirects, Redirect{Fd: fd, Op: op, Target: target})
+	return nil
+}
+
+// skipHeredocs consumes the bodies of pending here documents, which start
+// on the line after their redirection.
+func (p *parser) skipHeredocs() error {
+	for len(p.heredocs) > 0 {
+		delim := p.heredocs[0]
+		p.heredocs = p.heredocs[1:]
+		for {
+			if p.pos >= len(p.src) {
+				return fmt.Errorf("here document delimited by %q is not terminated", delim)
+			}
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			var line string
+			if end < 0 {
+				line = p.src[p.pos:]
+				p.pos = len(p.src)
+			} else {
+				line = p.src[p.pos : p.pos+end]
+				p.pos += end + 1
+			}
+			if strings.TrimLeft(line, "\t") == delim {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// readWord reads one word and returns it with quotes and escapes removed.
+// Command substitutions are kept verbatim in the word and parsed as nested
+// commands.
+func (p *parser) readWord() (string, error) {
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case strings.IndexByte(" \t\n;&|()<>", c) >= 0:
+			return b.String(), nil
+		case c == '\\':
+			if p.pos+1 < len(p.src) {
+				if p.src[p.pos+1] != '\n' {
+					b.WriteByte(p.src[p.pos+1])
+				}
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+		case c == '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated single quote")
+			}
+			b.WriteString(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case c == '"':
+			if err := p.readDoubleQuoted(&b); err != nil {
+				return "", err
+			}
+		case c == '$' && strings.HasPrefix(p.src[p.pos:], "$("):
+			sub, err := p.readSubstitution()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(sub)
+		case c == '`':
+			sub, err := p.readBackticks()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(sub)
+		case c == '$' && strings.HasPrefix(p.src[p.pos:], "${"):
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${")
+			}
+			b.WriteString(p.src[p.pos : p.pos+end+1])
+			p.pos += end + 1
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return b.String(), nil
+}
+
+func (p *parser) readDoubleQuoted(b *strings.Builder) error {
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return nil
+		case c == '\\' && p.pos+1 < len(p.src) && strings.IndexByte("$`\"\\\n", p.src[p.pos+1]) >= 0:
+			if p.src[p.pos+1] != '\n' {
+				b.WriteByte(p.src[p.pos+1])
+			}
+			p.pos += 2
+		case c == '$' && strings.HasPrefix(p.src[p.pos:], "$("):
+			sub, err := p.readSubstitution()
+			if err != nil {
+				return err
+			}
+			b.WriteString(sub)
+		case c == '`':
+			sub, err := p.readBackticks()
+			if err != nil {
+				return err
+			}
+			b.WriteString(sub)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return fmt.Errorf("unterminated double quote")
+}
+
+func (p *parser) readSubstitution() (string, error) {
+	start := p.pos
+	p.pos += 2
+	depth := 1
+	for p.pos < len(p.src) && depth > 0 {
+		switch p.src[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '\'':
+			if end := strings.IndexByte(p.src[p.pos+1:], '\''); end >= 0 {
+				p.pos += end + 1
+			}
+		case '\\':
+			p.pos++
+		}
+		p.pos++
+	}
+	if depth > 0 {
+		return "", fmt.Errorf("unterminated $(")
+	}
+	text := p.src[start:p.pos]
+	if strings.HasPrefix(text, "$((") {
+		// Arithmetic expansion, not a command.
+		return text, nil
+	}
+	return text, p.parseNested(text[2 : len(text)-1])
+}
+
+func (p *parser) readBackticks() (string, error) {
+	start := p.pos
+	end := strings.IndexByte(p.src[p.pos+1:], '`')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated backquote")
+	}
+	p.pos += end + 2
+	text := p.src[start:p.pos]
+	return text, p.parseNested(text[1 : len(text)-1])
+}
+
+func (p *parser) parseNested(src string) error {
+	sub := &parser{src: src}
+	if err := sub.parse(true); err != nil {
+		return err
+	}
+	p.cmds = append(p.cmds, sub.cmds...)
+	return nil
+}
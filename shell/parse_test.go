@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cmds, err := Parse(`cd /var/log && LANG=C grep -r "disk full" . 2>&1 | sort -u > /tmp/out.txt; echo 'done here' &`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Command{
+		{Program: "cd", Args: []string{"/var/log"}, Operator: "&&"},
+		{Program: "grep", Args: []string{"-r", "disk full", "."}, Assignments: []string{"LANG=C"},
+			Redirects: []Redirect{{Fd: "2", Op: ">&", Target: "1"}}, Operator: "|"},
+		{Program: "sort", Args: []string{"-u"}, Redirects: []Redirect{{Op: ">", Target: "/tmp/out.txt"}}, Operator: ";"},
+		{Program: "echo", Args: []string{"done here"}, Operator: "&"},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got  %+v\nwant %+v", cmds, want)
+	}
+}
+
+func TestParseSubstitutionAndHeredoc(t *testing.T) {
+	cmds, err := Parse("tar czf backup-$(date +%F).tgz /etc\ncat <<EOF > notes\n$(not a command)\nEOF\nif test -f x; then rm x; fi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var programs []string
+	for _, c := range cmds {
+		programs = append(programs, c.Program)
+	}
+	if want := []string{"date", "tar", "cat", "test", "rm"}; !reflect.DeepEqual(programs, want) {
+		t.Errorf("programs = %v, want %v", programs, want)
+	}
+	if !cmds[0].Nested || cmds[1].Nested {
+		t.Errorf("nested flags wrong: %+v", cmds[:2])
+	}
+	if got := cmds[2].Redirects; len(got) != 2 || got[0].Op != "<<" || got[1].Target != "notes" {
+		t.Errorf("cat redirects = %+v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, line := range []string{`echo 'open`, `echo "open`, `echo $(date`, "cat <<EOF\nno end", "echo >"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded", line)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"":           "''",
+		"plain/path": "plain/path",
+		"two words":  "'two words'",
+		"it's":       `'it'\''s'`,
+		"$HOME":      "'$HOME'",
+	} {
+		if got := Quote(in); got != want {
+			t.Errorf("Quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	for _, argv := range [][]string{
+		{"grep", "-r", "it's a $PATTERN", "/var/log/my dir"},
+		{"FOO=bar", "baz"},
+		{"if", "then"},
+		{"echo", "`id`", "$(id)", "a;b", "c|d", "~", "*", ""},
+		{"printf", "%s\n", "line\nbreak"},
+	} {
+		line := Join(argv)
+		cmds, err := Parse(line)
+		if err != nil {
+			t.Errorf("Parse(Join(%q)) = %v", argv, err)
+			continue
+		}
+		if len(cmds) != 1 || cmds[0].Program != argv[0] || len(cmds[0].Assignments) != 0 ||
+			!reflect.DeepEqual(cmds[0].Args, argv[1:]) {
+			t.Errorf("Join(%q) = %s, parsed as %+v", argv, line, cmds)
+		}
+	}
+}
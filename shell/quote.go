@@ -0,0 +1,44 @@
+// Package shell provides helpers for building POSIX shell command lines.
+package shell
+
+import "strings"
+
+// Quote returns s quoted for a POSIX shell so that it is passed through as a
+// single literal word.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if isSafe(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Join quotes every word of argv and joins them into a command line that
+// runs argv[0] with the remaining words as its arguments, with no expansion
+// of any kind.
+func Join(argv []string) string {
+	words := make([]string, len(argv))
+	for i, arg := range argv {
+		words[i] = Quote(arg)
+		// A bare first word could be taken for an assignment or a
+		// reserved word.
+		if i == 0 && words[i] == arg && (strings.Contains(arg, "=") || reservedWords[arg]) {
+			words[i] = "'" + arg + "'"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func isSafe(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_./=:,+@%", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"ssh-executor/config"
+	"ssh-executor/mcp"
+)
+
+type GetServerConfigArgs struct{}
+
+// ServerConfig is the structured result of get_server_config.
+type ServerConfig struct {
+	Source   string      `json:"source" description:"Config file the settings were read from, or \"environment\""`
+	LoadedAt string      `json:"loaded_at" description:"When the settings were last loaded (RFC 3339)"`
+	Config   config.File `json:"config" description:"Effective settings with secrets redacted"`
+}
+
+// RegisterConfig adds get_server_config to s. current returns the settings
+// in effect with their secrets already redacted.
+func RegisterConfig(s *mcp.Server, current func() ServerConfig) {
+	mcp.AddTool(s, "get_server_config", "Show the server's effective settings with secrets redacted", func(ctx context.Context, args GetServerConfigArgs) (*mcp.CallToolResult, error) {
+		cfg := current()
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return mcp.StructuredResult(string(data), cfg), nil
+	}, mcp.WithOutput[ServerConfig](), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:  mcp.Bool(true),
+		OpenWorldHint: mcp.Bool(false),
+	}))
+}
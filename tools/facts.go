@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-executor/executor"
+)
+
+// HostFacts summarizes a host's system.
+type HostFacts struct {
+	Host                 string      `json:"host"`
+	Hostname             string      `json:"hostname"`
+	OS                   string      `json:"os"`
+	Kernel               string      `json:"kernel"`
+	Arch                 string      `json:"arch"`
+	CPUs                 int         `json:"cpus"`
+	CPUModel             string      `json:"cpu_model,omitempty"`
+	MemoryTotalBytes     int64       `json:"memory_total_bytes,omitempty"`
+	MemoryAvailableBytes int64       `json:"memory_available_bytes,omitempty"`
+	UptimeSeconds        int64       `json:"uptime_seconds,omitempty"`
+	Disks                []DiskFacts `json:"disks"`
+	GatheredAt           time.Time   `json:"gathered_at"`
+}
+
+type DiskFacts struct {
+	Filesystem     string `json:"filesystem"`
+	Mount          string `json:"mount"`
+	SizeBytes      int64  `json:"size_bytes"`
+	UsedBytes      int64  `json:"used_bytes"`
+	AvailableBytes int64  `json:"available_bytes"`
+}
+
+// factsScript prints key=value lines followed by df output. Everything but
+// uname is optional so that it works on minimal and non-Linux systems.
+const factsScript = `echo "hostname=$(uname -n)"
+echo "kernel=$(uname -sr)"
+echo "arch=$(uname -m)"
+if [ -r /etc/os-release ]; then (. /etc/os-release && echo "os=$PRETTY_NAME"); else echo "os=$(uname -s)"; fi
+echo "cpus=$(getconf _NPROCESSORS_ONLN 2>/dev/null || nproc 2>/dev/null)"
+echo "cpu_model=$(sed -n 's/^model name[[:space:]]*: //p' /proc/cpuinfo 2>/dev/null | head -n 1)"
+sed -n 's/^MemTotal: *\([0-9]*\) kB/mem_total_kb=\1/p; s/^MemAvailable: *\([0-9]*\) kB/mem_available_kb=\1/p' /proc/meminfo 2>/dev/null
+[ -r /proc/uptime ] && echo "uptime=$(cut -d ' ' -f 1 /proc/uptime)"
+echo "--- df"
+df -Pk 2>/dev/null`
+
+type cachedFacts struct {
+	exec  executor.Executor
+	facts *HostFacts
+}
+
+// Facts returns the facts of the connection to host, gathering them on the
+// first call for each connection.
+func (t *Targets) Facts(ctx context.Context, host string) (*HostFacts, error) {
+	name, exec, err := t.Get(host)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	cached, ok := t.facts[name]
+	t.mu.Unlock()
+	if ok && cached.exec == exec {
+		return cached.facts, nil
+	}
+
+	res, err := exec.Run(ctx, factsScript, executor.RunOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 && res.Stdout == "" {
+		return nil, fmt.Errorf("gathering facts failed: exit status %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	facts := parseFacts(res.Stdout)
+	facts.Host = displayName(name)
+	facts.GatheredAt = time.Now().UTC()
+
+	t.mu.Lock()
+	if t.facts == nil {
+		t.facts = map[string]cachedFacts{}
+	}
+	t.facts[name] = cachedFacts{exec, facts}
+	t.mu.Unlock()
+	return facts, nil
+}
+
+func parseFacts(out string) *HostFacts {
+	facts := &HostFacts{Disks: []DiskFacts{}}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "--- df" {
+			break
+		}
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "hostname":
+			facts.Hostname = value
+		case "kernel":
+			facts.Kernel = value
+		case "arch":
+			facts.Arch = value
+		case "os":
+			facts.OS = value
+		case "cpus":
+			facts.CPUs, _ = strconv.Atoi(value)
+		case "cpu_model":
+			facts.CPUModel = value
+		case "mem_total_kb":
+			kb, _ := strconv.ParseInt(value, 10, 64)
+			facts.MemoryTotalBytes = kb * 1024
+		case "mem_available_kb":
+			kb, _ := strconv.ParseInt(value, 10, 64)
+			facts.MemoryAvailableBytes = kb * 1024
+		case "uptime":
+			secs, _ := strconv.ParseFloat(value, 64)
+			facts.UptimeSeconds = int64(secs)
+		}
+	}
+	// df -P: Filesystem 1024-blocks Used Available Capacity Mounted-on, with
+	// the mount point possibly containing spaces.
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+		size, err1 := strconv.ParseInt(fields[1], 10, 64)
+		used, err2 := strconv.ParseInt(fields[2], 10, 64)
+		avail, err3 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || size == 0 {
+			continue
+		}
+		facts.Disks = append(facts.Disks, DiskFacts{
+			Filesystem:     fields[0],
+			Mount:          strings.Join(fields[5:], " "),
+			SizeBytes:      size * 1024,
+			UsedBytes:      used * 1024,
+			AvailableBytes: avail * 1024,
+		})
+	}
+	return facts
+}
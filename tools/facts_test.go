@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"ssh-executor/executor"
+)
+
+const sampleFacts = `hostname=web1
+kernel=Linux 6.1.0-18-amd64
+arch=x86_64
+os=Debian GNU/Linux 12 (bookworm)
+cpus=4
+cpu_model=Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz
+mem_total_kb=8000000
+mem_available_kb=6000000
+uptime=12345.67
+--- df
+Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         40000000 8000000  32000000      20% /
+tmpfs                    0       0         0       0% /dev/shm
+/dev/sdb1          1000000  500000    500000      50% /mnt/my disk
+`
+
+func TestParseFacts(t *testing.T) {
+	f := parseFacts(sampleFacts)
+	if f.Hostname != "web1" || f.OS != "Debian GNU/Linux 12 (bookworm)" || f.CPUs != 4 ||
+		f.MemoryTotalBytes != 8000000*1024 || f.UptimeSeconds != 12345 {
+		t.Errorf("facts = %+v", f)
+	}
+	if len(f.Disks) != 2 || f.Disks[1].Mount != "/mnt/my disk" || f.Disks[0].AvailableBytes != 32000000*1024 {
+		t.Errorf("disks = %+v", f.Disks)
+	}
+}
+
+func TestFactsGatheredOncePerConnection(t *testing.T) {
+	var fake *executor.Fake
+	targets := &Targets{NewExecutor: func(name string) (executor.Executor, error) {
+		fake = executor.NewFake(func(cmd string, opts executor.RunOptions) (*executor.Result, error) {
+			return &executor.Result{Stdout: sampleFacts}, nil
+		})
+		return fake, nil
+	}}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := targets.Connect(ctx, "web1"); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			f, err := targets.Facts(ctx, "web1")
+			if err != nil || f.Host != "web1" || f.Kernel != "Linux 6.1.0-18-amd64" {
+				t.Fatalf("facts = %+v, %v", f, err)
+			}
+		}
+		if len(fake.Commands) != 1 {
+			t.Errorf("connection %d ran %d commands", i, len(fake.Commands))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+const defaultConcurrency = 10
+
+type ExecuteOnHostsArgs struct {
+	Hosts          []string `json:"hosts,omitempty" description:"Inventory hosts, selectors (group:<name>, tag:<key>=<value>, all) or [user@]host[:port] addresses"`
+	Group          string   `json:"group,omitempty" description:"Name of a host group"`
+	Command        string   `json:"command" description:"Shell command to execute on every host"`
+	Concurrency    int      `json:"concurrency,omitempty" description:"Maximum number of hosts to run on at once (default 10 unless configured)"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty" description:"Per-host timeout covering connect and execution"`
+}
+
+type HostResult struct {
+	Host       string `json:"host"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Truncated  bool   `json:"truncated" description:"stdout or stderr was cut to the output limit"`
+	Error      string `json:"error,omitempty"`
+}
+
+// OutputGroup collects hosts that produced identical output.
+type OutputGroup struct {
+	Hosts     []string `json:"hosts"`
+	Stdout    string   `json:"stdout"`
+	Stderr    string   `json:"stderr"`
+	ExitCode  int      `json:"exit_code"`
+	Truncated bool     `json:"truncated"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type FleetResult struct {
+	Results   []HostResult  `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Summary   []OutputGroup `json:"summary"`
+}
+
+// RegisterFleet adds execute_on_hosts to s. Every host gets a fresh
+// connection created through t. Commands are authorized by g.
+func RegisterFleet(s *mcp.Server, t *Targets, g *Guard) {
+	mcp.AddTool(s, "execute_on_hosts", "Execute a command on many hosts in parallel", func(ctx context.Context, args ExecuteOnHostsArgs) (*mcp.CallToolResult, error) {
+		selectors := args.Hosts
+		if args.Group != "" {
+			selectors = append(selectors, "group:"+args.Group)
+		}
+		hosts, err := t.Resolve(selectors)
+		if err != nil {
+			return mcp.ErrorResult(err.Error()), nil
+		}
+		if err := g.Authorize(ctx, hosts, args.Command); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command refused: %v", err)), nil
+		}
+		_, timeout := t.timeouts()
+		if args.TimeoutSeconds > 0 {
+			timeout = time.Duration(args.TimeoutSeconds) * time.Second
+		}
+		result := t.RunOnHosts(ctx, hosts, args.Command, args.Concurrency, timeout)
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return mcp.StructuredResult(string(data), result), nil
+	}, mcp.WithOutput[FleetResult](), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+	}))
+}
+
+// RunOnHosts executes cmd on every host with at most concurrency hosts in
+// flight, or Targets.Concurrency when concurrency is 0. Each host gets its
+// own connection, which is closed afterwards.
+func (t *Targets) RunOnHosts(ctx context.Context, hosts []string, cmd string, concurrency int, timeout time.Duration) *FleetResult {
+	if concurrency <= 0 {
+		t.settings.RLock()
+		concurrency = t.Concurrency
+		t.settings.RUnlock()
+	}
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	results := make([]HostResult, len(hosts))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = HostResult{Host: host, ExitCode: -1, Error: ctx.Err().Error()}
+				return
+			}
+			defer func() { <-sem }()
+			results[i] = t.runOne(ctx, host, cmd, timeout)
+		}()
+	}
+	wg.Wait()
+
+	res := &FleetResult{Results: results, Summary: summarize(results)}
+	for _, r := range results {
+		if r.Error == "" && r.ExitCode == 0 {
+			res.Succeeded++
+		} else {
+			res.Failed++
+		}
+	}
+	return res
+}
+
+func (t *Targets) runOne(ctx context.Context, host, cmd string, timeout time.Duration) HostResult {
+	start := time.Now()
+	result := HostResult{Host: host, ExitCode: -1}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	exec, err := t.NewExecutor(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer exec.Close()
+	if err := t.connect(ctx, exec); err != nil {
+		result.Error = fmt.Sprintf("connection failed: %v", err)
+		result.DurationMs = time.Since(start).Milliseconds()
+		return result
+	}
+	res, err := exec.Run(ctx, cmd, executor.RunOptions{})
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var cutOut, cutErr bool
+	result.Stdout, cutOut = truncateOutput(res.Stdout, t.maxOutput())
+	result.Stderr, cutErr = truncateOutput(res.Stderr, t.maxOutput())
+	result.Truncated = cutOut || cutErr
+	result.ExitCode = res.ExitCode
+	return result
+}
+
+func summarize(results []HostResult) []OutputGroup {
+	type key struct {
+		stdout, stderr, err string
+		code                int
+		truncated           bool
+	}
+	index := map[key]int{}
+	var groups []OutputGroup
+	for _, r := range results {
+		k := key{r.Stdout, r.Stderr, r.Error, r.ExitCode, r.Truncated}
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, OutputGroup{Stdout: r.Stdout, Stderr: r.Stderr, ExitCode: r.ExitCode, Truncated: r.Truncated, Error: r.Error})
+		}
+		groups[i].Hosts = append(groups[i].Hosts, r.Host)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Hosts) != len(groups[j].Hosts) {
+			return len(groups[i].Hosts) > len(groups[j].Hosts)
+		}
+		return strings.Join(groups[i].Hosts, ",") < strings.Join(groups[j].Hosts, ",")
+	})
+	return groups
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ssh-executor/executor"
+)
+
+func TestFleetRun(t *testing.T) {
+	var inFlight, maxInFlight int32
+	targets := &Targets{
+		NewExecutor: func(host string) (executor.Executor, error) {
+			if host == "bad" {
+				return nil, errors.New("unknown host")
+			}
+			return executor.NewFake(func(cmd string, opts executor.RunOptions) (*executor.Result, error) {
+				n := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+				for {
+					m := atomic.LoadInt32(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				if host == "web3" {
+					return &executor.Result{Stdout: "down\n", Stderr: "connection refused by upstream\n", ExitCode: 1}, nil
+				}
+				return &executor.Result{Stdout: "up\n"}, nil
+			}), nil
+		},
+		Groups:         map[string][]string{"web": {"web1", "web2", "web3"}},
+		MaxOutputBytes: 10,
+	}
+
+	hosts, err := targets.Resolve([]string{"web1", "bad", "group:web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web1", "bad", "web2", "web3"}; !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("resolved %v, want %v", hosts, want)
+	}
+
+	res := targets.RunOnHosts(context.Background(), hosts, "uptime", 2, 0)
+	if res.Succeeded != 2 || res.Failed != 2 {
+		t.Errorf("succeeded=%d failed=%d", res.Succeeded, res.Failed)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("%d hosts ran at once, limit was 2", maxInFlight)
+	}
+	if res.Results[1].Host != "bad" || res.Results[1].Error == "" {
+		t.Errorf("bad host result = %+v", res.Results[1])
+	}
+	if r := res.Results[3]; r.Stderr != "connection" || !r.Truncated || res.Results[0].Truncated {
+		t.Errorf("web3 result = %+v, web1 result = %+v", r, res.Results[0])
+	}
+	if len(res.Summary) != 3 {
+		t.Fatalf("summary = %+v", res.Summary)
+	}
+	if got := res.Summary[0].Hosts; !reflect.DeepEqual(got, []string{"web1", "web2"}) {
+		t.Errorf("largest group = %v", got)
+	}
+
+	if _, err := targets.Resolve([]string{"group:db"}); err == nil {
+		t.Error("unknown group resolved")
+	}
+}
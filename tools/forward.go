@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/forward"
+	"ssh-executor/mcp"
+)
+
+type StartPortForwardArgs struct {
+	Host   string `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to the only open connection"`
+	Type   string `json:"type,omitempty" enum:"local|remote|dynamic" description:"local: listen here, connect from the remote host; remote: listen on the remote host, connect from here; dynamic: local SOCKS5 proxy (default local)"`
+	Listen string `json:"listen,omitempty" description:"Address to listen on, e.g. 127.0.0.1:5432 (default 127.0.0.1 on a free port)"`
+	Target string `json:"target,omitempty" description:"host:port to connect to; required for local and remote forwards"`
+}
+
+type StopPortForwardArgs struct {
+	ID string `json:"id" description:"Forward id returned by start_port_forward"`
+}
+
+type ListPortForwardsArgs struct{}
+
+type forwardInfo struct {
+	ID                string `json:"id"`
+	Host              string `json:"host"`
+	Type              string `json:"type"`
+	ListenAddress     string `json:"listen_address"`
+	ListensOn         string `json:"listens_on"`
+	Target            string `json:"target,omitempty"`
+	Started           string `json:"started"`
+	ActiveConnections int64  `json:"active_connections"`
+	TotalConnections  int64  `json:"total_connections"`
+}
+
+// forwards holds the running port forwards by id. A forward removes itself
+// when it stops, including when its connection is closed.
+type forwards struct {
+	mu     sync.Mutex
+	nextID int
+	byID   map[string]*forwardEntry
+}
+
+type forwardEntry struct {
+	id   string
+	host string
+	*forward.Forward
+}
+
+func (fs *forwards) add(host string, f *forward.Forward) *forwardEntry {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.nextID++
+	e := &forwardEntry{id: "fwd-" + strconv.Itoa(fs.nextID), host: host, Forward: f}
+	fs.byID[e.id] = e
+	go func() {
+		<-f.Done()
+		fs.mu.Lock()
+		delete(fs.byID, e.id)
+		fs.mu.Unlock()
+	}()
+	return e
+}
+
+func (fs *forwards) list() []forwardInfo {
+	fs.mu.Lock()
+	entries := make([]*forwardEntry, 0, len(fs.byID))
+	for _, e := range fs.byID {
+		entries = append(entries, e)
+	}
+	fs.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Started.Before(entries[j].Started) })
+	infos := make([]forwardInfo, len(entries))
+	for i, e := range entries {
+		infos[i] = e.info()
+	}
+	return infos
+}
+
+func (e *forwardEntry) info() forwardInfo {
+	active, total := e.Connections()
+	on := "local"
+	if e.Kind == forward.Remote {
+		on = "remote"
+	}
+	return forwardInfo{
+		ID:                e.id,
+		Host:              displayName(e.host),
+		Type:              string(e.Kind),
+		ListenAddress:     e.Listen,
+		ListensOn:         on,
+		Target:            e.Target,
+		Started:           e.Started.UTC().Format(time.RFC3339),
+		ActiveConnections: active,
+		TotalConnections:  total,
+	}
+}
+
+// RegisterForwards adds start_port_forward, list_port_forwards and
+// stop_port_forward to s. Forwards use the connections held by t and stop
+// when their connection closes.
+func RegisterForwards(s *mcp.Server, t *Targets) {
+	fs := &forwards{byID: map[string]*forwardEntry{}}
+
+	mcp.AddTool(s, "start_port_forward", "Forward a port through an SSH connection: local, remote or dynamic (SOCKS5)", func(ctx context.Context, args StartPortForwardArgs) (*mcp.CallToolResult, error) {
+		kind := forward.Kind(args.Type)
+		if kind == "" {
+			kind = forward.Local
+		}
+		if kind != forward.Dynamic && args.Target == "" {
+			return mcp.ErrorResult(fmt.Sprintf("target parameter required for %s forwards", kind)), nil
+		}
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Port forward failed: %v", err)), nil
+		}
+		tun, ok := exec.(executor.Tunneler)
+		if !ok {
+			return mcp.ErrorResult(fmt.Sprintf("Port forward failed: the %s connection cannot carry tunnels", displayName(host))), nil
+		}
+		f, err := forward.Start(tun, kind, args.Listen, args.Target)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Port forward failed: %v", err)), nil
+		}
+		return jsonResult(fs.add(host, f).info())
+	}, mcp.WithOutput[forwardInfo](), mcp.WithAvailability(t.needTunnels), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(false),
+	}))
+
+	mcp.AddTool(s, "list_port_forwards", "List running port forwards", func(ctx context.Context, args ListPortForwardsArgs) (*mcp.CallToolResult, error) {
+		forwards := fs.list()
+		res, err := jsonResult(forwards)
+		if err == nil {
+			res.StructuredContent = ForwardList{Forwards: forwards}
+		}
+		return res, err
+	}, mcp.WithOutput[ForwardList](), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:  mcp.Bool(true),
+		OpenWorldHint: mcp.Bool(false),
+	}))
+
+	mcp.AddTool(s, "stop_port_forward", "Stop a port forward", func(ctx context.Context, args StopPortForwardArgs) (*mcp.CallToolResult, error) {
+		fs.mu.Lock()
+		e, ok := fs.byID[args.ID]
+		fs.mu.Unlock()
+		if !ok {
+			return mcp.ErrorResult(fmt.Sprintf("no port forward %q", args.ID)), nil
+		}
+		e.Close()
+		fs.mu.Lock()
+		delete(fs.byID, args.ID)
+		fs.mu.Unlock()
+		out := StopForwardOutput{ID: args.ID, ListenAddress: e.Listen}
+		return mcp.StructuredResult(fmt.Sprintf("Stopped %s (%s)", args.ID, e.Listen), out), nil
+	}, mcp.WithOutput[StopForwardOutput](), mcp.WithAvailability(t.needTunnels), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(false),
+		OpenWorldHint:   mcp.Bool(false),
+	}))
+}
+
+// jsonResult returns v as indented JSON text and as structured content.
+func jsonResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.StructuredResult(string(data), v), nil
+}
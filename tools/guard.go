@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"ssh-executor/mcp"
+	"ssh-executor/policy"
+	"ssh-executor/shell"
+)
+
+// Guard checks commands against a policy and asks the human, through MCP
+// elicitation, to approve the ones that need confirmation.
+type Guard struct {
+	// Policy is read under a lock; change it with SetPolicy once the server
+	// runs.
+	Policy *policy.Policy
+	// Logger receives refused and approved commands; nil discards them.
+	Logger *slog.Logger
+	// Audit receives a record of every command checked, whatever the
+	// outcome; nil discards them.
+	Audit  *slog.Logger
+	server *mcp.Server
+	mu     sync.RWMutex
+}
+
+func NewGuard(s *mcp.Server, p *policy.Policy) *Guard {
+	return &Guard{Policy: p, server: s}
+}
+
+// Decision is the outcome of a policy check: "allow", "confirm" or "deny".
+type Decision struct {
+	Action string `json:"action"`
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decide reports what Authorize would do with cmd without asking anyone.
+func (g *Guard) Decide(cmd string) Decision {
+	if g == nil {
+		return Decision{Action: "allow"}
+	}
+	return decision(g.policy().Check(cmd))
+}
+
+func decision(rule *policy.Rule) Decision {
+	if rule == nil {
+		return Decision{Action: "allow"}
+	}
+	return Decision{Action: string(rule.Action), Rule: rule.Name, Reason: rule.Reason}
+}
+
+// DecideScript reports what AuthorizeScript would do with a script without
+// asking anyone.
+func (g *Guard) DecideScript(interpreter, script, text string) Decision {
+	if g == nil {
+		return Decision{Action: "allow"}
+	}
+	return decision(g.checkScript(interpreter, script, text))
+}
+
+// checkScript returns the rule that applies to a script run as text. Only
+// shell scripts can be split into commands and checked; any other script,
+// or a shell script that does not parse, needs approval unless a rule
+// denies it.
+func (g *Guard) checkScript(interpreter, script, text string) *policy.Rule {
+	p := g.policy()
+	if p == nil || len(p.Rules) == 0 {
+		return nil
+	}
+	rule := p.Check(text)
+	if rule != nil && rule.Action == policy.Deny {
+		return rule
+	}
+	if interpreter != "bash" && interpreter != "sh" {
+		return &policy.Rule{Name: "unchecked-script", Action: policy.Confirm, Reason: interpreter + " scripts cannot be checked against the policy"}
+	}
+	if _, err := shell.Parse(script); err != nil {
+		return &policy.Rule{Name: "unchecked-script", Action: policy.Confirm, Reason: fmt.Sprintf("the script cannot be checked against the policy: %v", err)}
+	}
+	return rule
+}
+
+// SetPolicy replaces the policy for the commands checked from now on.
+func (g *Guard) SetPolicy(p *policy.Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Policy = p
+}
+
+func (g *Guard) policy() *policy.Policy {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.Policy
+}
+
+// CanConfirm reports whether the client can be asked for approval.
+func (g *Guard) CanConfirm() bool {
+	return g != nil && g.server.ClientSupports("elicitation")
+}
+
+// Authorize returns nil if cmd may run on hosts.
+func (g *Guard) Authorize(ctx context.Context, hosts []string, cmd string) error {
+	if g == nil {
+		return nil
+	}
+	return g.authorize(ctx, hosts, cmd, g.policy().Check(cmd))
+}
+
+// AuthorizeScript returns nil if a script for interpreter may run on hosts.
+// text is the script as shown to the human, with the interpreter line.
+func (g *Guard) AuthorizeScript(ctx context.Context, hosts []string, interpreter, script, text string) error {
+	if g == nil {
+		return nil
+	}
+	return g.authorize(ctx, hosts, text, g.checkScript(interpreter, script, text))
+}
+
+// authorize applies rule, if any, to cmd and audits the outcome.
+func (g *Guard) authorize(ctx context.Context, hosts []string, cmd string, rule *policy.Rule) error {
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = displayName(h)
+	}
+	var err error
+	if rule != nil {
+		err = g.confirm(ctx, names, cmd, rule)
+		log := orDiscard(g.Logger).With("logger", "policy", "rule", rule.Name, "action", string(rule.Action), "hosts", names)
+		if err != nil {
+			log.Warn("command refused", "reason", err)
+		} else {
+			log.Info("command approved")
+		}
+	}
+	if g.Audit != nil {
+		d := decision(rule)
+		attrs := []interface{}{"hosts", names, "command", cmd, "decision", d.Action, "allowed", err == nil}
+		if rule != nil {
+			attrs = append(attrs, "rule", d.Rule)
+		}
+		if err != nil {
+			attrs = append(attrs, "reason", err.Error())
+		}
+		g.Audit.Info("command", attrs...)
+	}
+	return err
+}
+
+// confirm asks the human to approve cmd matching rule, unless the rule
+// denies it outright.
+func (g *Guard) confirm(ctx context.Context, names []string, cmd string, rule *policy.Rule) error {
+	if rule.Action == policy.Deny {
+		return fmt.Errorf("command denied by policy rule %q: %s", rule.Name, rule.Reason)
+	}
+	message := fmt.Sprintf("Approve running this command on %s?\n\n%s\n\nMatched rule %q: %s",
+		strings.Join(names, ", "), cmd, rule.Name, rule.Reason)
+	res, err := g.server.Elicit(ctx, message, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"approve": map[string]interface{}{
+				"type":        "boolean",
+				"title":       "Run the command",
+				"description": "Confirm that the command shown above may run",
+				"default":     true,
+			},
+		},
+	})
+	if errors.Is(err, mcp.ErrElicitationUnsupported) {
+		return fmt.Errorf("command requires human approval (rule %q: %s) but the client does not support elicitation", rule.Name, rule.Reason)
+	}
+	if err != nil {
+		return fmt.Errorf("approval request failed: %v", err)
+	}
+	if !res.Accepted() {
+		return fmt.Errorf("command was not approved (%s)", res.Action)
+	}
+	if approve, ok := res.Content["approve"].(bool); ok && !approve {
+		return fmt.Errorf("command was not approved")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"ssh-executor/inventory"
+	"ssh-executor/mcp"
+)
+
+type ListHostsArgs struct {
+	Group string `json:"group,omitempty" description:"Only list hosts in this group"`
+	Tag   string `json:"tag,omitempty" description:"Only list hosts with this tag, as key or key=value"`
+}
+
+type hostEntry struct {
+	*inventory.Host
+	Connected bool `json:"connected"`
+}
+
+// RegisterInventory adds list_hosts to s.
+func RegisterInventory(s *mcp.Server, t *Targets) {
+	mcp.AddTool(s, "list_hosts", "List inventory hosts, optionally filtered by group or tag", func(ctx context.Context, args ListHostsArgs) (*mcp.CallToolResult, error) {
+		connected := map[string]bool{}
+		for _, name := range t.Connected() {
+			connected[name] = true
+		}
+		entries := []hostEntry{}
+		for _, h := range t.inventory().Filter(args.Group, args.Tag) {
+			entries = append(entries, hostEntry{Host: h, Connected: connected[h.Name]})
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return mcp.StructuredResult(string(data), HostList{Hosts: entries}), nil
+	}, mcp.WithOutput[HostList](), mcp.WithAvailability(t.needInventory), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:  mcp.Bool(true),
+		OpenWorldHint: mcp.Bool(false),
+	}))
+}
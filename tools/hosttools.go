@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+type HostToolArgs struct {
+	DryRun bool `json:"dry_run,omitempty" description:"Only report what would run: target, policy decision, programs, files and redirections"`
+}
+
+// RegisterHostTools adds the tools that inventory hosts define to s. Each
+// runs its fixed command on its host, authorized by g, and is listed only
+// while that host is connected. It returns the names of the tools added and
+// adds none if one of them would replace an existing tool.
+func RegisterHostTools(s *mcp.Server, t *Targets, g *Guard) ([]string, error) {
+	hosts := t.inventory().Hosts()
+	var names []string
+	for _, h := range hosts {
+		for _, tool := range h.Tools {
+			if s.HasTool(tool.Name) {
+				return nil, fmt.Errorf("host %s: tool %q is already registered", h.Name, tool.Name)
+			}
+			names = append(names, tool.Name)
+		}
+	}
+	for _, h := range hosts {
+		for _, tool := range h.Tools {
+			addHostTool(s, t, g, h.Name, tool.Name, tool.Description, tool.Command)
+		}
+	}
+	return names, nil
+}
+
+func addHostTool(s *mcp.Server, t *Targets, g *Guard, host, name, description, cmd string) {
+	if description == "" {
+		description = fmt.Sprintf("Run %q on %s", cmd, host)
+	}
+	mcp.AddTool(s, name, description, func(ctx context.Context, args HostToolArgs) (*mcp.CallToolResult, error) {
+		if args.DryRun {
+			plan := newPlan(name, t, host)
+			plan.describeCommand(g, cmd)
+			return planResult(plan)
+		}
+		_, exec, err := t.Get(host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		if err := g.Authorize(ctx, []string{host}, cmd); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command refused: %v", err)), nil
+		}
+		ctx, cancel := t.withCommandTimeout(ctx)
+		defer cancel()
+		res, err := exec.Run(ctx, cmd, executor.RunOptions{})
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		return commandResult(commandOutput(host, res, t.maxOutput()), t.maxOutput()), nil
+	}, withPlan[CommandOutput](), mcp.WithAvailability(t.needHost(host)), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+	}))
+}
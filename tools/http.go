@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+const (
+	defaultHTTPTimeout   = 30 * time.Second
+	defaultHTTPBodyLimit = 64 << 10
+	maxHTTPRedirects     = 10
+)
+
+type HTTPRequestArgs struct {
+	Host            string            `json:"host,omitempty" description:"Inventory host name or [user@]host[:port] whose connection carries the request; defaults to the only open connection"`
+	Method          string            `json:"method,omitempty" enum:"GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS" description:"HTTP method (default GET)"`
+	URL             string            `json:"url" description:"http or https URL as seen from the remote host, e.g. http://localhost:8080/health"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Request headers"`
+	Body            string            `json:"body,omitempty" description:"Request body"`
+	BodyEncoding    string            `json:"body_encoding,omitempty" enum:"utf-8|base64" description:"Encoding of body (default utf-8)"`
+	TimeoutSeconds  int               `json:"timeout_seconds,omitempty" description:"Timeout for the whole request (default 30)"`
+	MaxBodyBytes    int               `json:"max_body_bytes,omitempty" description:"Truncate the response body after this many bytes (default 65536)"`
+	FollowRedirects bool              `json:"follow_redirects,omitempty" description:"Follow up to 10 redirects instead of returning the redirect response"`
+	Insecure        bool              `json:"insecure,omitempty" description:"Skip TLS certificate verification"`
+}
+
+type HTTPResponse struct {
+	URL          string            `json:"url"`
+	Status       string            `json:"status"`
+	StatusCode   int               `json:"status_code"`
+	Proto        string            `json:"proto"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`
+	BodyEncoding string            `json:"body_encoding"`
+	BodyBytes    int               `json:"body_bytes"`
+	Truncated    bool              `json:"truncated"`
+	DurationMs   int64             `json:"duration_ms"`
+}
+
+// RegisterHTTP adds http_request to s. Requests are dialled from the remote
+// end of the connections held by t.
+func RegisterHTTP(s *mcp.Server, t *Targets) {
+	mcp.AddTool(s, "http_request", "Send an HTTP request from the remote host's point of view, through the SSH connection", func(ctx context.Context, args HTTPRequestArgs) (*mcp.CallToolResult, error) {
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("HTTP request failed: %v", err)), nil
+		}
+		tun, ok := exec.(executor.Tunneler)
+		if !ok {
+			return mcp.ErrorResult(fmt.Sprintf("HTTP request failed: the %s connection cannot carry tunnels", displayName(host))), nil
+		}
+		resp, err := doHTTP(ctx, tun, args)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("HTTP request failed: %v", err)), nil
+		}
+		return jsonResult(resp)
+	}, mcp.WithOutput[HTTPResponse](), mcp.WithAvailability(t.needTunnels), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+	}))
+}
+
+func doHTTP(ctx context.Context, tun executor.Tunneler, args HTTPRequestArgs) (*HTTPResponse, error) {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	body := []byte(args.Body)
+	switch args.BodyEncoding {
+	case "", "utf-8":
+	case "base64":
+		if body, err = base64.StdEncoding.DecodeString(args.Body); err != nil {
+			return nil, fmt.Errorf("invalid base64 body: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported body encoding %q", args.BodyEncoding)
+	}
+	method := strings.ToUpper(args.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := defaultHTTPTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = time.Duration(args.TimeoutSeconds) * time.Second
+	}
+	limit := defaultHTTPBodyLimit
+	if args.MaxBodyBytes > 0 {
+		limit = args.MaxBodyBytes
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range args.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return tun.Dial(ctx, addr)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: args.Insecure},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !args.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxHTTPRedirects {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %v", err)
+	}
+
+	out := &HTTPResponse{
+		URL:          resp.Request.URL.String(),
+		Status:       resp.Status,
+		StatusCode:   resp.StatusCode,
+		Proto:        resp.Proto,
+		Headers:      map[string]string{},
+		BodyEncoding: "utf-8",
+		DurationMs:   time.Since(start).Milliseconds(),
+	}
+	if len(data) > limit {
+		data = data[:limit]
+		out.Truncated = true
+	}
+	text := data
+	if out.Truncated {
+		text = trimPartialRune(data)
+	}
+	if utf8.Valid(text) {
+		out.Body = string(text)
+		out.BodyBytes = len(text)
+	} else {
+		out.Body = base64.StdEncoding.EncodeToString(data)
+		out.BodyEncoding = "base64"
+		out.BodyBytes = len(data)
+	}
+	for k, v := range resp.Header {
+		out.Headers[k] = strings.Join(v, ", ")
+	}
+	return out, nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence cut off by truncation.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ssh-executor/executor"
+)
+
+func TestDoHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Method", r.Method)
+			fmt.Fprintf(w, "%s %s %s", r.Header.Get("X-Token"), r.Host, body)
+		case "/big":
+			io.WriteString(w, strings.Repeat("é", 100))
+		case "/moved":
+			http.Redirect(w, r, "/echo", http.StatusFound)
+		case "/binary":
+			w.Write([]byte{0xff, 0x00, 0xfe})
+		}
+	}))
+	defer srv.Close()
+	tun := executor.NewLocalExecutor()
+	ctx := context.Background()
+
+	resp, err := doHTTP(ctx, tun, HTTPRequestArgs{
+		Method:  "post",
+		URL:     srv.URL + "/echo",
+		Headers: map[string]string{"X-Token": "t1", "Host": "internal.example"},
+		Body:    "aGVsbG8=", BodyEncoding: "base64",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Body != "t1 internal.example hello" || resp.Headers["X-Method"] != "POST" {
+		t.Errorf("echo = %+v", resp)
+	}
+
+	resp, err = doHTTP(ctx, tun, HTTPRequestArgs{URL: srv.URL + "/big", MaxBodyBytes: 11})
+	if err != nil || !resp.Truncated || resp.Body != strings.Repeat("é", 5) || resp.BodyBytes != 10 {
+		t.Errorf("truncated = %+v, %v", resp, err)
+	}
+
+	resp, err = doHTTP(ctx, tun, HTTPRequestArgs{URL: srv.URL + "/moved"})
+	if err != nil || resp.StatusCode != http.StatusFound || resp.Headers["Location"] != "/echo" {
+		t.Errorf("redirect = %+v, %v", resp, err)
+	}
+	resp, err = doHTTP(ctx, tun, HTTPRequestArgs{URL: srv.URL + "/moved", FollowRedirects: true})
+	if err != nil || resp.StatusCode != 200 || !strings.HasSuffix(resp.URL, "/echo") {
+		t.Errorf("followed redirect = %+v, %v", resp, err)
+	}
+
+	resp, err = doHTTP(ctx, tun, HTTPRequestArgs{URL: srv.URL + "/binary"})
+	if err != nil || resp.BodyEncoding != "base64" || resp.Body != "/wD+" {
+		t.Errorf("binary = %+v, %v", resp, err)
+	}
+
+	if _, err := doHTTP(ctx, tun, HTTPRequestArgs{URL: "ftp://example.com/"}); err == nil {
+		t.Error("ftp URL accepted")
+	}
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+// ElicitPrompter relays keyboard-interactive prompts that the configuration
+// cannot answer to the human through MCP elicitation.
+func ElicitPrompter(s *mcp.Server) executor.Prompter {
+	return func(ctx context.Context, host, instruction string, questions []string, echos []bool) ([]string, error) {
+		props := map[string]interface{}{}
+		required := make([]string, len(questions))
+		for i, q := range questions {
+			key := "answer" + strconv.Itoa(i+1)
+			desc := "Answer to the server's prompt"
+			if !echos[i] {
+				desc += " (normally hidden while typing)"
+			}
+			props[key] = map[string]interface{}{
+				"type":        "string",
+				"title":       strings.TrimSpace(q),
+				"description": desc,
+			}
+			required[i] = key
+		}
+		message := fmt.Sprintf("%s asks for keyboard-interactive login:\n\n%s", host, strings.Join(questions, "\n"))
+		if instruction != "" {
+			message = fmt.Sprintf("%s asks for keyboard-interactive login (%s):\n\n%s", host, instruction, strings.Join(questions, "\n"))
+		}
+		res, err := s.Elicit(ctx, message, map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		})
+		if errors.Is(err, mcp.ErrElicitationUnsupported) {
+			return nil, fmt.Errorf("keyboard-interactive prompt %q has no configured answer and the client does not support elicitation", strings.TrimSpace(questions[0]))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("keyboard-interactive prompt failed: %v", err)
+		}
+		if !res.Accepted() {
+			return nil, fmt.Errorf("keyboard-interactive login was not answered (%s)", res.Action)
+		}
+		answers := make([]string, len(questions))
+		for i, key := range required {
+			answer, ok := res.Content[key].(string)
+			if !ok {
+				return nil, fmt.Errorf("no answer to keyboard-interactive prompt %q", strings.TrimSpace(questions[i]))
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	}
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"ssh-executor/mcp"
+)
+
+// defaultMaxOutputBytes is how much of each of stdout and stderr a command
+// result keeps when Targets.MaxOutputBytes is not set.
+const defaultMaxOutputBytes = 1 << 20
+
+// CommandOutput is the structured result of execute_command.
+type CommandOutput struct {
+	Host       string `json:"host"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Truncated  bool   `json:"truncated" description:"stdout or stderr was cut to the output limit"`
+}
+
+type ConnectOutput struct {
+	Connected []string `json:"connected" description:"Hosts connected by this call; \"default\" for the configured SSH_HOST"`
+}
+
+type DisconnectOutput struct {
+	Disconnected []string `json:"disconnected"`
+}
+
+type UploadOutput struct {
+	Host  string `json:"host"`
+	Path  string `json:"path"`
+	Bytes int    `json:"bytes"`
+}
+
+type DownloadOutput struct {
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding" enum:"utf-8|base64"`
+	Bytes    int    `json:"bytes"`
+}
+
+type HostList struct {
+	Hosts []hostEntry `json:"hosts"`
+}
+
+type ForwardList struct {
+	Forwards []forwardInfo `json:"forwards"`
+}
+
+type PoolList struct {
+	Pools []hostPool `json:"pools"`
+}
+
+type StopForwardOutput struct {
+	ID            string `json:"id"`
+	ListenAddress string `json:"listen_address"`
+}
+
+// withPlan declares the output schema of O for a tool taking dry_run. A dry
+// run returns only {"plan": ...}, so no property is required. Dry runs are
+// accepted while the tool is unavailable, so that the plan can report why
+// the call would fail.
+func withPlan[O any]() mcp.ToolOption {
+	schema := mcp.SchemaFor[O]()
+	schema["properties"].(map[string]interface{})["plan"] = mcp.SchemaFor[Plan]()
+	delete(schema, "required")
+	output := mcp.WithOutputSchema(schema)
+	dryRuns := mcp.WithUnavailableCalls(isDryRun)
+	return func(tool *mcp.Tool) {
+		output(tool)
+		dryRuns(tool)
+	}
+}
+
+// isDryRun reports whether tool arguments set dry_run.
+func isDryRun(args json.RawMessage) bool {
+	var a struct {
+		DryRun bool `json:"dry_run"`
+	}
+	return json.Unmarshal(args, &a) == nil && a.DryRun
+}
+
+// maxOutput returns the per-stream output limit.
+func (t *Targets) maxOutput() int {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	if t.MaxOutputBytes > 0 {
+		return t.MaxOutputBytes
+	}
+	return defaultMaxOutputBytes
+}
+
+// truncateOutput cuts s to at most limit bytes without splitting a UTF-8
+// sequence.
+func truncateOutput(s string, limit int) (string, bool) {
+	if len(s) <= limit {
+		return s, false
+	}
+	return string(trimPartialRune([]byte(s[:limit]))), true
+}
+
+// truncatedNote is appended to the text of a truncated result.
+func truncatedNote(limit int) string {
+	return fmt.Sprintf("\n[output truncated to %d bytes per stream]", limit)
+}
@@ -0,0 +1,19 @@
+package tools
+
+import (
+	"testing"
+
+	"ssh-executor/executor"
+)
+
+func TestCommandOutputTruncation(t *testing.T) {
+	res := &executor.Result{Stdout: "héllo", Stderr: "ok", ExitCode: 3}
+	out := commandOutput("", res, 2)
+	// "é" is two bytes; the cut must not split it.
+	if out.Stdout != "h" || out.Stderr != "ok" || !out.Truncated || out.Host != "default" || out.ExitCode != 3 {
+		t.Errorf("commandOutput = %+v", out)
+	}
+	if out := commandOutput("web1", res, 100); out.Truncated || out.Stdout != "héllo" {
+		t.Errorf("commandOutput = %+v", out)
+	}
+}
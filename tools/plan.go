@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ssh-executor/mcp"
+	"ssh-executor/shell"
+)
+
+// Plan describes what a tool call would do. It is returned instead of
+// running anything when a tool is called with dry_run.
+type Plan struct {
+	DryRun          bool             `json:"dry_run"`
+	Tool            string           `json:"tool"`
+	Host            string           `json:"host,omitempty"`
+	Target          string           `json:"target,omitempty"`
+	Connected       bool             `json:"connected"`
+	ConnectionError string           `json:"connection_error,omitempty"`
+	Policy          *Decision        `json:"policy,omitempty"`
+	Command         string           `json:"command,omitempty"`
+	Env             []string         `json:"env,omitempty"`
+	Cwd             string           `json:"cwd,omitempty"`
+	Commands        []shell.Command  `json:"commands,omitempty"`
+	Programs        []string         `json:"programs,omitempty"`
+	Files           []string         `json:"files,omitempty"`
+	Redirections    []shell.Redirect `json:"redirections,omitempty"`
+	Transfer        *TransferPlan    `json:"transfer,omitempty"`
+	Script          *ScriptPlan      `json:"script,omitempty"`
+	Warnings        []string         `json:"warnings,omitempty"`
+}
+
+// TransferPlan describes a file upload or download.
+type TransferPlan struct {
+	Direction string `json:"direction"`
+	Path      string `json:"path"`
+	Bytes     int    `json:"bytes,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+// ScriptPlan describes a script run by run_script.
+type ScriptPlan struct {
+	Interpreter string   `json:"interpreter"`
+	Mode        string   `json:"mode"`
+	Bytes       int      `json:"bytes"`
+	Args        []string `json:"args,omitempty"`
+}
+
+// newPlan resolves the connection for host without opening a session.
+func newPlan(tool string, t *Targets, host string) *Plan {
+	plan := &Plan{DryRun: true, Tool: tool}
+	name, exec, err := t.Get(host)
+	if err != nil {
+		plan.Host = host
+		plan.ConnectionError = err.Error()
+		plan.Warnings = append(plan.Warnings, "the call would fail: no usable connection")
+		return plan
+	}
+	plan.Host = displayName(name)
+	plan.Connected = true
+	plan.Target = describeTarget(exec)
+	return plan
+}
+
+// describeCommand fills in the policy decision and the parsed structure of
+// cmd.
+func (plan *Plan) describeCommand(g *Guard, cmd string) {
+	plan.Command = cmd
+	plan.describePolicy(g, g.Decide(cmd))
+	plan.describeParsed(cmd)
+}
+
+// describeParsed fills in the parsed structure of cmd.
+func (plan *Plan) describeParsed(cmd string) {
+	cmds, err := shell.Parse(cmd)
+	if err != nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("could not parse command: %v", err))
+		return
+	}
+	plan.Commands = cmds
+
+	seenProgram := map[string]bool{}
+	seenFile := map[string]bool{}
+	addFile := func(f string) {
+		if !seenFile[f] {
+			seenFile[f] = true
+			plan.Files = append(plan.Files, f)
+		}
+	}
+	for _, c := range cmds {
+		for _, prog := range programsOf(c) {
+			if !seenProgram[prog] {
+				seenProgram[prog] = true
+				plan.Programs = append(plan.Programs, prog)
+			}
+		}
+		for _, arg := range c.Args {
+			if f, ok := pathArg(arg); ok {
+				addFile(f)
+			}
+		}
+		for _, r := range c.Redirects {
+			plan.Redirections = append(plan.Redirections, r)
+			if isFileRedirect(r) {
+				addFile(r.Target)
+			}
+		}
+		if c.Nested {
+			plan.Warnings = appendOnce(plan.Warnings, "the command uses command substitution; nested commands run first")
+		}
+		if c.Operator == "&" {
+			plan.Warnings = appendOnce(plan.Warnings, fmt.Sprintf("%s would run in the background", c.Program))
+		}
+	}
+}
+
+// describePolicy fills in a policy decision of g.
+func (plan *Plan) describePolicy(g *Guard, decision Decision) {
+	plan.Policy = &decision
+	switch decision.Action {
+	case "deny":
+		plan.Warnings = append(plan.Warnings, "the command would be refused by policy")
+	case "confirm":
+		if g.CanConfirm() {
+			plan.Warnings = append(plan.Warnings, "the command would need human approval")
+		} else {
+			plan.Warnings = append(plan.Warnings, "the command needs human approval, which this client cannot give; it would be refused")
+		}
+	}
+}
+
+// describeEnv lists the names of the variables set for the command and its
+// working directory. Values are left out as they often hold secrets.
+func (plan *Plan) describeEnv(env map[string]string, cwd string) {
+	for name := range env {
+		plan.Env = append(plan.Env, name)
+	}
+	sort.Strings(plan.Env)
+	plan.Cwd = cwd
+}
+
+// wrappers run the program named by their first operand.
+var wrappers = map[string]bool{
+	"sudo": true, "env": true, "nohup": true, "time": true, "nice": true,
+	"ionice": true, "xargs": true, "exec": true, "command": true, "timeout": true,
+	"stdbuf": true, "watch": true,
+}
+
+func programsOf(c shell.Command) []string {
+	if c.Program == "" {
+		return nil
+	}
+	progs := []string{c.Program}
+	prog, args := c.Program, c.Args
+	for wrappers[prog] {
+		next := ""
+		skipValue := prog == "timeout"
+		for i, a := range args {
+			if strings.HasPrefix(a, "-") || (prog == "env" && strings.Contains(a, "=")) {
+				continue
+			}
+			if skipValue {
+				skipValue = false
+				continue
+			}
+			next, args = a, args[i+1:]
+			break
+		}
+		if next == "" {
+			break
+		}
+		progs = append(progs, next)
+		prog = next
+	}
+	return progs
+}
+
+// pathArg reports whether a command argument looks like a file path,
+// including the value of key=/path style arguments.
+func pathArg(arg string) (string, bool) {
+	if strings.HasPrefix(arg, "-") {
+		if _, v, ok := strings.Cut(arg, "="); ok {
+			arg = v
+		} else {
+			return "", false
+		}
+	} else if k, v, ok := strings.Cut(arg, "="); ok && !strings.ContainsAny(k, "/.") {
+		arg = v
+	}
+	if strings.Contains(arg, "://") || strings.HasPrefix(arg, "$(") || strings.HasPrefix(arg, "`") {
+		return "", false
+	}
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "~") || strings.HasPrefix(arg, "./") ||
+		strings.HasPrefix(arg, "../") || arg == "." || arg == ".." {
+		return arg, true
+	}
+	if strings.Contains(arg, "/") && !strings.ContainsAny(arg, " \t") {
+		return arg, true
+	}
+	return "", false
+}
+
+func isFileRedirect(r shell.Redirect) bool {
+	switch r.Op {
+	case "<<", "<<-", "<<<":
+		return false
+	case ">&", "<&":
+		return strings.Trim(r.Target, "0123456789-") != ""
+	}
+	return true
+}
+
+func appendOnce(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func planResult(plan *Plan) (*mcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.StructuredResult(string(data), map[string]interface{}{"plan": plan}), nil
+}
@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/policy"
+)
+
+func TestPlanDescribeCommand(t *testing.T) {
+	fake := executor.NewFake(nil)
+	targets := &Targets{NewExecutor: func(string) (executor.Executor, error) { return fake, nil }}
+	if _, err := targets.Connect(context.Background(), "web1"); err != nil {
+		t.Fatal(err)
+	}
+	guard := NewGuard(mcp.NewServer("test", "0"), policy.Default())
+
+	plan := newPlan("execute_command", targets, "")
+	plan.describeCommand(guard, "sudo systemctl restart nginx && tail -n 5 /var/log/nginx/error.log 2>&1 > out.txt &")
+	if !plan.Connected || plan.Host != "web1" || plan.Target != "fake" {
+		t.Errorf("plan target = %+v", plan)
+	}
+	if plan.Policy == nil || plan.Policy.Action != "confirm" || plan.Policy.Rule != "service-change" {
+		t.Errorf("policy = %+v", plan.Policy)
+	}
+	if want := []string{"sudo", "systemctl", "tail"}; !reflect.DeepEqual(plan.Programs, want) {
+		t.Errorf("programs = %q, want %q", plan.Programs, want)
+	}
+	if want := []string{"/var/log/nginx/error.log", "out.txt"}; !reflect.DeepEqual(plan.Files, want) {
+		t.Errorf("files = %q, want %q", plan.Files, want)
+	}
+	if len(plan.Redirections) != 2 || len(plan.Warnings) != 2 {
+		t.Errorf("redirections = %+v, warnings = %q", plan.Redirections, plan.Warnings)
+	}
+	if len(fake.Commands) != 0 {
+		t.Errorf("dry run ran %q", fake.Commands)
+	}
+
+	plan = newPlan("execute_command", &Targets{}, "")
+	plan.describeCommand(guard, "echo 'unterminated")
+	if plan.Connected || plan.ConnectionError == "" || plan.Commands != nil || len(plan.Warnings) != 2 {
+		t.Errorf("broken plan = %+v", plan)
+	}
+}
+
+func TestPathArg(t *testing.T) {
+	for arg, want := range map[string]string{
+		"/etc/hosts":       "/etc/hosts",
+		"~/.bashrc":        "~/.bashrc",
+		"logs/app.log":     "logs/app.log",
+		"of=/dev/sda":      "/dev/sda",
+		"--config=./a.yml": "./a.yml",
+		"-rf":              "",
+		"https://x.io/a":   "",
+		"nginx":            "",
+	} {
+		got, _ := pathArg(arg)
+		if got != want {
+			t.Errorf("pathArg(%q) = %q, want %q", arg, got, want)
+		}
+	}
+}
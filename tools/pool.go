@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+type GetPoolStatsArgs struct {
+	Host string `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to every open SSH connection"`
+}
+
+type hostPool struct {
+	Host string `json:"host"`
+	executor.PoolStats
+}
+
+// RegisterPool adds get_pool_stats to s.
+func RegisterPool(s *mcp.Server, t *Targets) {
+	mcp.AddTool(s, "get_pool_stats", "Show the SSH connections and sessions used to run commands on each host", func(ctx context.Context, args GetPoolStatsArgs) (*mcp.CallToolResult, error) {
+		hosts := t.Connected()
+		if args.Host != "" {
+			host, _, err := t.Get(args.Host)
+			if err != nil {
+				return mcp.ErrorResult(err.Error()), nil
+			}
+			hosts = []string{host}
+		}
+		pools := []hostPool{}
+		for _, host := range hosts {
+			_, exec, err := t.Get(host)
+			if err != nil {
+				continue
+			}
+			pooler, ok := exec.(executor.Pooler)
+			if !ok {
+				if args.Host != "" {
+					return mcp.ErrorResult(fmt.Sprintf("the %s connection has no connection pool", displayName(host))), nil
+				}
+				continue
+			}
+			pools = append(pools, hostPool{Host: displayName(host), PoolStats: pooler.PoolStats()})
+		}
+		data, err := json.MarshalIndent(pools, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return mcp.StructuredResult(string(data), PoolList{Pools: pools}), nil
+	}, mcp.WithOutput[PoolList](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:  mcp.Bool(true),
+		OpenWorldHint: mcp.Bool(false),
+	}))
+}
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"ssh-executor/mcp"
+)
+
+//go:embed prompts/*.md
+var builtinPrompts embed.FS
+
+// promptTemplate is a prompt loaded from a template file: YAML front matter
+// between "---" lines followed by a text/template body. The body sees each
+// argument by name and the host facts as .facts, nil when unavailable.
+type promptTemplate struct {
+	mcp.Prompt `yaml:",inline"`
+	body       *template.Template
+}
+
+var promptFuncs = template.FuncMap{"bytes": formatBytes}
+
+// RegisterPrompts adds the built-in runbook prompts to s, followed by the
+// *.md templates in dir, which replace built-in prompts of the same name.
+// Every prompt is sent with the facts of the host named by its host argument,
+// or of the default connection.
+func RegisterPrompts(s *mcp.Server, t *Targets, dir string) error {
+	prompts, err := loadPrompts(builtinPrompts, "prompts")
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		extra, err := loadPrompts(os.DirFS(dir), ".")
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		prompts = append(prompts, extra...)
+	}
+	for _, p := range prompts {
+		s.AddPrompt(p.Prompt, func(ctx context.Context, args map[string]string) (*mcp.GetPromptResult, error) {
+			return p.render(ctx, t, args)
+		})
+	}
+	return nil
+}
+
+func loadPrompts(fsys fs.FS, dir string) ([]*promptTemplate, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var prompts []*promptTemplate
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		p, err := parsePrompt(strings.TrimSuffix(path.Base(name), ".md"), string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Base(name), err)
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+func parsePrompt(name, text string) (*promptTemplate, error) {
+	p := &promptTemplate{}
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		header, body, ok := strings.Cut(rest, "\n---\n")
+		if !ok {
+			return nil, fmt.Errorf("front matter is not closed by ---")
+		}
+		if err := yaml.Unmarshal([]byte(header), &p.Prompt); err != nil {
+			return nil, err
+		}
+		text = body
+	}
+	if p.Name == "" {
+		p.Name = name
+	}
+	for i, arg := range p.Arguments {
+		if arg.Name == "" {
+			return nil, fmt.Errorf("argument %d has no name", i+1)
+		}
+	}
+	body, err := template.New(p.Name).Funcs(promptFuncs).Option("missingkey=zero").Parse(strings.TrimSpace(text))
+	if err != nil {
+		return nil, err
+	}
+	p.body = body
+	return p, nil
+}
+
+// render executes the template and attaches the host facts as an embedded
+// ssh://<host>/facts resource. Facts that cannot be gathered are reported in
+// the text rather than failing the prompt.
+func (p *promptTemplate) render(ctx context.Context, t *Targets, args map[string]string) (*mcp.GetPromptResult, error) {
+	data := map[string]interface{}{}
+	for _, arg := range p.Arguments {
+		data[arg.Name] = ""
+	}
+	for k, v := range args {
+		data[k] = v
+	}
+
+	host := args["host"]
+	if host == "default" {
+		host = ""
+	}
+	var messages []mcp.PromptMessage
+	facts, err := t.Facts(ctx, host)
+	if err == nil {
+		data["facts"] = facts
+		text, err := json.MarshalIndent(facts, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, mcp.PromptMessage{Role: "user", Content: mcp.PromptContent{
+			Type: "resource",
+			Resource: &mcp.ResourceContents{
+				URI:      "ssh://" + url.PathEscape(facts.Host) + "/facts",
+				MimeType: "application/json",
+				Text:     string(text),
+			},
+		}})
+	} else {
+		data["facts"] = nil
+	}
+
+	var b bytes.Buffer
+	if err := p.body.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	text := b.String()
+	if facts == nil {
+		text += fmt.Sprintf("\n\n(Host facts are unavailable: %v.)", err)
+	}
+	messages = append(messages, mcp.PromptMessage{Role: "user", Content: mcp.PromptContent{Type: "text", Text: text}})
+	return &mcp.GetPromptResult{Description: p.Description, Messages: messages}, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+)
+
+func TestPrompts(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "restart-web.md"), []byte("---\ndescription: Restart the web tier\narguments:\n  - name: service\n    required: true\n---\nRestart {{.service}} on {{.facts.Hostname}} ({{bytes .facts.MemoryTotalBytes}}).\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "disk-space-cleanup.md"), []byte("Clean up {{.host}}.\n"), 0644)
+
+	targets := &Targets{NewExecutor: func(name string) (executor.Executor, error) {
+		return executor.NewFake(func(cmd string, opts executor.RunOptions) (*executor.Result, error) {
+			return &executor.Result{Stdout: sampleFacts}, nil
+		}), nil
+	}}
+	builtin, err := loadPrompts(builtinPrompts, "prompts")
+	if err != nil || len(builtin) != 3 {
+		t.Fatalf("built-in prompts = %v, %v", builtin, err)
+	}
+	extra, err := loadPrompts(os.DirFS(dir), ".")
+	if err != nil || len(extra) != 2 {
+		t.Fatalf("prompts from dir = %v, %v", extra, err)
+	}
+	prompts := map[string]*promptTemplate{}
+	for _, p := range append(builtin, extra...) {
+		prompts[p.Name] = p
+	}
+	render := func(name string, args map[string]string) *mcp.GetPromptResult {
+		t.Helper()
+		res, err := prompts[name].render(context.Background(), targets, args)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res
+	}
+
+	res := render("investigate-failing-service", map[string]string{"unit": "nginx.service"})
+	if len(res.Messages) != 1 || !strings.Contains(res.Messages[0].Content.Text, "Host facts are unavailable") {
+		t.Errorf("prompt without connection: %+v", res)
+	}
+
+	targets.Connect(context.Background(), "web1")
+	res = render("restart-web", map[string]string{"service": "nginx"})
+	if len(res.Messages) != 2 || res.Messages[0].Content.Resource == nil || res.Messages[0].Content.Resource.URI != "ssh://web1/facts" ||
+		res.Messages[1].Content.Text != "Restart nginx on web1 (7.6 GiB)." || res.Description != "Restart the web tier" {
+		t.Errorf("restart-web = %+v", res)
+	}
+	if res := render("disk-space-cleanup", map[string]string{"host": "web1"}); res.Messages[1].Content.Text != "Clean up web1." {
+		t.Errorf("prompt from dir = %+v", res)
+	}
+	if res := render("diagnose-high-load", nil); !strings.Contains(res.Messages[1].Content.Text, "its 4 CPUs and 7.6 GiB of memory") {
+		t.Errorf("diagnose-high-load = %s", res.Messages[1].Content.Text)
+	}
+}
+
+func TestParsePromptErrors(t *testing.T) {
+	for _, text := range []string{
+		"---\ndescription: x\nno end",
+		"---\narguments:\n  - description: nameless\n---\nbody",
+		"---\n: [bad yaml\n---\nbody",
+		"{{.unclosed",
+	} {
+		if _, err := parsePrompt("p", text); err == nil {
+			t.Errorf("parsePrompt(%q) succeeded", text)
+		}
+	}
+}
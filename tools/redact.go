@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"ssh-executor/mcp"
+)
+
+// Redacter removes secrets from text and returns how many it removed, as
+// redact.Redactor and redact.Reloadable do.
+type Redacter interface {
+	Redact(text string) (string, int)
+}
+
+// RedactResults returns a result filter that removes secrets from the text
+// and structured content of every tool result and reports the number removed
+// from the text as _meta.redactions.
+//
+// Base64 payloads, such as binary downloads and HTTP bodies, would be
+// corrupted by redaction and look like high-entropy tokens, so they are left
+// as they are. Their decoded bytes are checked instead, and a result whose
+// payload holds a secret is replaced by an error.
+func RedactResults(r Redacter) mcp.ResultFilter {
+	return func(tool string, res *mcp.CallToolResult) {
+		var generic interface{}
+		if res.StructuredContent != nil {
+			generic = toGeneric(res.StructuredContent)
+		}
+		payloads := base64Payloads(generic)
+		for _, p := range payloads {
+			if n := payloadSecrets(r, p); n > 0 {
+				*res = *mcp.ErrorResult("Result withheld: " + withheld(n))
+				res.Meta = map[string]interface{}{"redactions": n}
+				return
+			}
+		}
+
+		total := 0
+		for i := range res.Content {
+			text, n := redactAround(r, res.Content[i].Text, payloads)
+			res.Content[i].Text = text
+			total += n
+		}
+		if res.StructuredContent != nil {
+			res.StructuredContent = redactStructured(r, generic, payloads)
+		}
+		if res.Meta == nil {
+			res.Meta = map[string]interface{}{}
+		}
+		res.Meta["redactions"] = total
+	}
+}
+
+// RedactResources returns a resource filter that removes secrets from text
+// resource contents. Binary contents are checked like the base64 payloads of
+// tool results: a blob holding a secret fails the read.
+func RedactResources(r Redacter) mcp.ResourceFilter {
+	return func(uri string, contents *mcp.ResourceContents) error {
+		contents.Text, _ = r.Redact(contents.Text)
+		if contents.Blob == "" {
+			return nil
+		}
+		if n := payloadSecrets(r, contents.Blob); n > 0 {
+			return fmt.Errorf("%s withheld: %s", uri, withheld(n))
+		}
+		return nil
+	}
+}
+
+// payloadSecrets returns the number of secrets in the decoded bytes of a
+// base64 payload.
+func payloadSecrets(r Redacter, payload string) int {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return 0
+	}
+	_, n := r.Redact(string(data))
+	return n
+}
+
+func withheld(secrets int) string {
+	return fmt.Sprintf("the base64 content contains %d secret(s), and redacting it would corrupt the data", secrets)
+}
+
+// toGeneric returns v as generic JSON, or nil if it cannot be encoded.
+func toGeneric(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil
+	}
+	return generic
+}
+
+// base64Payloads returns the base64 values of the content and body fields
+// of the objects in v that mark them as such, as DownloadOutput and
+// HTTPResponse do.
+func base64Payloads(v interface{}) []string {
+	var payloads []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for field, encoding := range map[string]string{"content": "encoding", "body": "body_encoding"} {
+				if p, ok := v[field].(string); ok && p != "" && v[encoding] == "base64" {
+					payloads = append(payloads, p)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	return payloads
+}
+
+// redactAround redacts text except for occurrences of the payloads.
+func redactAround(r Redacter, text string, payloads []string) (string, int) {
+	for _, p := range payloads {
+		if parts := strings.Split(text, p); len(parts) > 1 {
+			total := 0
+			for i, part := range parts {
+				var n int
+				parts[i], n = redactAround(r, part, payloads)
+				total += n
+			}
+			return strings.Join(parts, p), total
+		}
+	}
+	return r.Redact(text)
+}
+
+// redactStructured removes secrets from every string value of the generic
+// JSON v except the payloads. Content that could not be encoded arrives as
+// nil and is dropped rather than sent unredacted.
+func redactStructured(r Redacter, v interface{}, payloads []string) interface{} {
+	keep := map[string]bool{}
+	for _, p := range payloads {
+		keep[p] = true
+	}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case string:
+			if keep[v] {
+				return v
+			}
+			text, _ := r.Redact(v)
+			return text
+		case map[string]interface{}:
+			for k, e := range v {
+				v[k] = walk(e)
+			}
+		case []interface{}:
+			for i, e := range v {
+				v[i] = walk(e)
+			}
+		}
+		return v
+	}
+	return walk(v)
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/shell"
+)
+
+const (
+	factsTemplate = "ssh://{host}/facts"
+	fileTemplate  = "ssh://{host}/{path}"
+)
+
+// RegisterResources exposes the open connections as MCP resources:
+// ssh://<host>/facts for system facts and ssh://<host>/<path> for remote
+// files, where <path> is absolute without its leading slash. The default
+// connection is named "default".
+func RegisterResources(s *mcp.Server, t *Targets) {
+	s.AddResourceTemplate(mcp.ResourceTemplate{
+		URITemplate: factsTemplate,
+		Name:        "Host facts",
+		Description: "OS, kernel, CPU, memory and disks of a connected host, gathered once per connection",
+		MimeType:    "application/json",
+	}, func(ctx context.Context, uri string, vars map[string]string) ([]mcp.ResourceContents, error) {
+		host, err := resourceHost(vars)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := t.Get(host); err != nil {
+			return nil, resourceError(err)
+		}
+		facts, err := t.Facts(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(facts, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{{URI: uri, MimeType: "application/json", Text: string(data)}}, nil
+	}, func(ctx context.Context) []mcp.Resource {
+		var resources []mcp.Resource
+		for _, name := range t.Connected() {
+			resources = append(resources, mcp.Resource{
+				URI:      "ssh://" + url.PathEscape(displayName(name)) + "/facts",
+				Name:     displayName(name) + " facts",
+				MimeType: "application/json",
+			})
+		}
+		return resources
+	})
+
+	s.AddResourceTemplate(mcp.ResourceTemplate{
+		URITemplate: fileTemplate,
+		Name:        "Remote file",
+		Description: "A file on a connected host; the path is absolute, e.g. ssh://web1/etc/hosts. Add ?offset=<bytes> to read only what follows that offset. Subscribe to be notified of changes",
+	}, func(ctx context.Context, uri string, vars map[string]string) ([]mcp.ResourceContents, error) {
+		host, p, offset, err := resourceFile(vars)
+		if err != nil {
+			return nil, err
+		}
+		_, exec, err := t.Get(host)
+		if err != nil {
+			return nil, resourceError(err)
+		}
+		data, err := readFile(ctx, exec, p, offset)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		mimeType := mime.TypeByExtension(path.Ext(p))
+		if !utf8.Valid(data) {
+			if mimeType == "" {
+				mimeType = "application/octet-stream"
+			}
+			return []mcp.ResourceContents{{URI: uri, MimeType: mimeType, Blob: base64.StdEncoding.EncodeToString(data)}}, nil
+		}
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
+		return []mcp.ResourceContents{{URI: uri, MimeType: mimeType, Text: string(data)}}, nil
+	}, nil)
+
+	s.SetResourceWatcher(newFileWatcher(t, watchInterval))
+}
+
+// resourceFile splits the variables of a file resource URI into the
+// connection name, the absolute path and the offset query parameter.
+func resourceFile(vars map[string]string) (host, p string, offset int64, err error) {
+	if host, err = resourceHost(vars); err != nil {
+		return "", "", 0, err
+	}
+	rawPath, rawQuery, _ := strings.Cut(vars["path"], "?")
+	if p, err = url.PathUnescape(rawPath); err != nil {
+		return "", "", 0, fmt.Errorf("invalid path %q: %v", rawPath, err)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid query %q: %v", rawQuery, err)
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 64); err != nil || offset < 0 {
+			return "", "", 0, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return host, "/" + p, offset, nil
+}
+
+// readFile reads the file at p from offset on.
+func readFile(ctx context.Context, exec executor.Executor, p string, offset int64) ([]byte, error) {
+	if offset == 0 {
+		return exec.Download(ctx, p)
+	}
+	res, err := exec.Run(ctx, fmt.Sprintf("tail -c +%d %s", offset+1, shell.Quote(p)), executor.RunOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+	}
+	return []byte(res.Stdout), nil
+}
+
+// resourceHost maps the host of a resource URI to a connection name.
+func resourceHost(vars map[string]string) (string, error) {
+	host, err := url.PathUnescape(vars["host"])
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %v", vars["host"], err)
+	}
+	if host == "default" {
+		return "", nil
+	}
+	return host, nil
+}
+
+// resourceError reports missing connections as unknown resources.
+func resourceError(err error) error {
+	return fmt.Errorf("%w: %v", mcp.ErrResourceNotFound, err)
+}
@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/shell"
+)
+
+type RunScriptArgs struct {
+	Host           string            `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to the only open connection"`
+	Interpreter    string            `json:"interpreter,omitempty" enum:"bash|sh|python3|perl|pwsh" description:"Interpreter for the script (default bash)"`
+	Script         string            `json:"script" description:"Script body, passed verbatim; no quoting or escaping needed"`
+	Args           []string          `json:"args,omitempty" description:"Arguments passed to the script"`
+	Mode           string            `json:"mode,omitempty" enum:"stdin|file" description:"How the script reaches the interpreter: streamed over stdin, or written to a temporary file that is removed afterwards (default stdin; pwsh always uses file). Use file when the script reads its own stdin"`
+	Env            map[string]string `json:"env,omitempty" description:"Environment variables for the script"`
+	Cwd            string            `json:"cwd,omitempty" description:"Working directory for the script (default: the login directory)"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" description:"Kill the script after this many seconds"`
+	DryRun         bool              `json:"dry_run,omitempty" description:"Only report what would run; nothing is run on the host"`
+}
+
+type ScriptResult struct {
+	Host        string `json:"host"`
+	Interpreter string `json:"interpreter"`
+	Mode        string `json:"mode"`
+	ExitCode    int    `json:"exit_code"`
+	Stdout      string `json:"stdout"`
+	Stderr      string `json:"stderr"`
+	DurationMs  int64  `json:"duration_ms"`
+	Truncated   bool   `json:"truncated" description:"stdout or stderr was cut to the output limit"`
+	TimedOut    bool   `json:"timed_out,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// interpreters maps each interpreter to how it reads a script from stdin and
+// from a file. An empty stdin form means the interpreter needs a file.
+var interpreters = map[string]struct {
+	stdin []string
+	file  []string
+	ext   string
+}{
+	"bash":    {[]string{"bash", "-s", "--"}, []string{"bash"}, ".sh"},
+	"sh":      {[]string{"sh", "-s", "--"}, []string{"sh"}, ".sh"},
+	"python3": {[]string{"python3", "-"}, []string{"python3"}, ".py"},
+	"perl":    {[]string{"perl", "-"}, []string{"perl"}, ".pl"},
+	"pwsh":    {nil, []string{"pwsh", "-NoProfile", "-NonInteractive", "-File"}, ".ps1"},
+}
+
+// cleanupTimeout bounds the removal of a script's temporary directory after
+// the script itself was cancelled.
+const cleanupTimeout = 10 * time.Second
+
+// RegisterScript adds run_script to s. Shell scripts are authorized by g
+// command by command, with the interpreter line prepended; scripts for other
+// interpreters always need approval.
+func RegisterScript(s *mcp.Server, t *Targets, g *Guard) {
+	mcp.AddTool(s, "run_script", "Run a multi-line script on the remote server with bash, sh, python3, perl or pwsh", func(ctx context.Context, args RunScriptArgs) (*mcp.CallToolResult, error) {
+		if err := executor.CheckEnv(args.Env); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Script failed: %v", err)), nil
+		}
+		if err := normalizeScriptArgs(&args); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Script failed: %v", err)), nil
+		}
+		text := shell.Join(append([]string{args.Interpreter}, args.Args...)) + "\n" + args.Script
+		if args.DryRun {
+			plan := newPlan("run_script", t, args.Host)
+			plan.Command = text
+			plan.describePolicy(g, g.DecideScript(args.Interpreter, args.Script, text))
+			if args.Interpreter == "bash" || args.Interpreter == "sh" {
+				plan.describeParsed(text)
+			} else {
+				plan.Programs = []string{args.Interpreter}
+			}
+			plan.describeEnv(args.Env, args.Cwd)
+			plan.Script = &ScriptPlan{Interpreter: args.Interpreter, Mode: args.Mode, Bytes: len(args.Script), Args: args.Args}
+			return planResult(plan)
+		}
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Script failed: %v", err)), nil
+		}
+		if err := g.AuthorizeScript(ctx, []string{host}, args.Interpreter, args.Script, text); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Script refused: %v", err)), nil
+		}
+
+		_, timeout := t.timeouts()
+		if args.TimeoutSeconds > 0 {
+			timeout = time.Duration(args.TimeoutSeconds) * time.Second
+		}
+		result := runScript(ctx, exec, args, timeout)
+		result.Host = displayName(host)
+		var cutOut, cutErr bool
+		result.Stdout, cutOut = truncateOutput(result.Stdout, t.maxOutput())
+		result.Stderr, cutErr = truncateOutput(result.Stderr, t.maxOutput())
+		result.Truncated = cutOut || cutErr
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		res := mcp.StructuredResult(string(data), result)
+		res.IsError = result.Error != "" || result.ExitCode != 0
+		return res, nil
+	}, withPlan[ScriptResult](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+	}))
+}
+
+// normalizeScriptArgs fills in defaults and rejects unknown interpreters and
+// modes.
+func normalizeScriptArgs(args *RunScriptArgs) error {
+	if args.Script == "" {
+		return fmt.Errorf("script parameter required")
+	}
+	if args.Interpreter == "" {
+		args.Interpreter = "bash"
+	}
+	interp, ok := interpreters[args.Interpreter]
+	if !ok {
+		return fmt.Errorf("unsupported interpreter %q", args.Interpreter)
+	}
+	switch args.Mode {
+	case "":
+		args.Mode = "stdin"
+		if interp.stdin == nil {
+			args.Mode = "file"
+		}
+	case "stdin":
+		if interp.stdin == nil {
+			return fmt.Errorf("%s cannot read a script from stdin; use mode file", args.Interpreter)
+		}
+	case "file":
+	default:
+		return fmt.Errorf("unsupported mode %q", args.Mode)
+	}
+	return nil
+}
+
+// runScript runs the script on e. In file mode the script is written to a
+// private directory under $TMPDIR that the wrapping shell removes on exit;
+// if the run is cancelled or times out, the directory is removed by a
+// separate command since the shell may have been killed before its trap ran.
+func runScript(ctx context.Context, e executor.Executor, args RunScriptArgs, timeout time.Duration) *ScriptResult {
+	result := &ScriptResult{Interpreter: args.Interpreter, Mode: args.Mode, ExitCode: -1}
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	interp := interpreters[args.Interpreter]
+	opts := executor.RunOptions{Stdin: strings.NewReader(args.Script), Env: args.Env, Dir: args.Cwd}
+
+	var cmd, dir string
+	if args.Mode == "stdin" {
+		cmd = "exec " + shell.Join(append(append([]string{}, interp.stdin...), args.Args...))
+	} else {
+		var err error
+		if dir, err = scriptDir(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		cmd = fileScriptCommand(dir, "script"+interp.ext, interp.file, args.Args)
+	}
+
+	start := time.Now()
+	res, err := e.Run(runCtx, cmd, opts)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		if dir != "" && runCtx.Err() != nil {
+			cleanCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+			defer cancel()
+			e.Run(cleanCtx, "rm -rf "+dir, executor.RunOptions{Env: args.Env})
+		}
+		result.TimedOut = errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+		if result.TimedOut {
+			result.Error = fmt.Sprintf("timed out after %s", timeout)
+		} else {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	result.ExitCode = res.ExitCode
+	result.Stdout = res.Stdout
+	result.Stderr = res.Stderr
+	return result
+}
+
+// scriptDir returns an unguessable directory name under $TMPDIR, still
+// unexpanded so that it is resolved on the remote host.
+func scriptDir() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return `"${TMPDIR:-/tmp}/mcp-script-` + hex.EncodeToString(b) + `"`, nil
+}
+
+// fileScriptCommand creates dir with mode 0700, failing if it exists, copies
+// stdin to a script file inside it and runs the script with stdin closed.
+// The trap removes the directory however the shell exits.
+func fileScriptCommand(dir, name string, interp, args []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "d=%s\n", dir)
+	b.WriteString(`mkdir -m 700 "$d" || exit 125` + "\n")
+	b.WriteString(`trap 'rm -rf "$d"' EXIT` + "\n")
+	b.WriteString("trap 'exit 129' HUP; trap 'exit 130' INT; trap 'exit 143' TERM\n")
+	fmt.Fprintf(&b, `cat > "$d/%s" || exit 125`+"\n", name)
+	fmt.Fprintf(&b, `%s "$d/%s"`, shell.Join(interp), name)
+	if len(args) > 0 {
+		b.WriteString(" " + shell.Join(args))
+	}
+	b.WriteString(" </dev/null")
+	return b.String()
+}
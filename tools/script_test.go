@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/policy"
+)
+
+func TestRunScript(t *testing.T) {
+	tmp := t.TempDir()
+	local := executor.NewLocalExecutor()
+	ctx := context.Background()
+	script := "printf '%s|' \"$@\"\ncat <<'EOF'\nit's \"quoted\" $HOME\nEOF\n"
+
+	for _, mode := range []string{"stdin", "file"} {
+		args := RunScriptArgs{Interpreter: "sh", Script: script, Args: []string{"a b", "$c"}, Mode: mode, Env: map[string]string{"TMPDIR": tmp}}
+		if err := normalizeScriptArgs(&args); err != nil {
+			t.Fatal(err)
+		}
+		res := runScript(ctx, local, args, 0)
+		if res.Error != "" || res.ExitCode != 0 || res.Stdout != "a b|$c|it's \"quoted\" $HOME\n" {
+			t.Errorf("%s: %+v", mode, res)
+		}
+	}
+
+	args := RunScriptArgs{Interpreter: "sh", Script: "echo oops >&2; exit 3", Mode: "file", Env: map[string]string{"TMPDIR": tmp}}
+	normalizeScriptArgs(&args)
+	if res := runScript(ctx, local, args, 0); res.ExitCode != 3 || res.Stderr != "oops\n" {
+		t.Errorf("exit status: %+v", res)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	if _, err := exec.LookPath("python3"); err == nil {
+		args := RunScriptArgs{Interpreter: "python3", Script: "import sys\nprint(sys.argv[1:])\n", Args: []string{"x"}}
+		normalizeScriptArgs(&args)
+		if res := runScript(ctx, local, args, 0); res.Stdout != "['x']\n" {
+			t.Errorf("python3: %+v", res)
+		}
+	}
+}
+
+func TestRunScriptCleansUpAfterTimeout(t *testing.T) {
+	var cleanup string
+	fake := executor.NewFake(func(cmd string, opts executor.RunOptions) (*executor.Result, error) {
+		if strings.HasPrefix(cmd, "rm -rf ") {
+			cleanup = cmd
+			return &executor.Result{}, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil, context.DeadlineExceeded
+	})
+	fake.Connect(context.Background())
+
+	args := RunScriptArgs{Interpreter: "pwsh", Script: "Start-Sleep 60"}
+	if err := normalizeScriptArgs(&args); err != nil || args.Mode != "file" {
+		t.Fatalf("pwsh mode = %q, %v", args.Mode, err)
+	}
+	res := runScript(context.Background(), fake, args, time.Millisecond)
+	if !res.TimedOut || res.ExitCode != -1 {
+		t.Errorf("result = %+v", res)
+	}
+	run := fake.Commands[0]
+	if !strings.Contains(run, `pwsh -NoProfile -NonInteractive -File "$d/script.ps1"`) {
+		t.Errorf("command = %s", run)
+	}
+	dir := strings.TrimPrefix(strings.SplitN(run, "\n", 2)[0], "d=")
+	if cleanup != "rm -rf "+dir || !strings.Contains(dir, "mcp-script-") {
+		t.Errorf("cleanup = %q for %s", cleanup, dir)
+	}
+}
+
+func TestNormalizeScriptArgs(t *testing.T) {
+	for _, args := range []RunScriptArgs{
+		{Script: "x", Interpreter: "ruby"},
+		{Script: "x", Interpreter: "pwsh", Mode: "stdin"},
+		{Script: "x", Mode: "pipe"},
+		{Interpreter: "sh"},
+	} {
+		if err := normalizeScriptArgs(&args); err == nil {
+			t.Errorf("%+v accepted", args)
+		}
+	}
+}
+
+func TestAuthorizeScript(t *testing.T) {
+	guard := NewGuard(mcp.NewServer("test", "0"), policy.Default())
+	ctx := context.Background()
+	for _, tc := range []struct {
+		interpreter, script, action, rule string
+	}{
+		{"bash", "set -e\ncd /srv/app\ngit pull\n", "allow", ""},
+		{"bash", "echo deploying\nsystemctl restart nginx\n", "confirm", "service-change"},
+		{"sh", "if [ -f /run/reboot-required ]; then\n  /sbin/reboot\nfi\n", "confirm", "power"},
+		{"bash", "cd /tmp\nrm -rf /\n", "deny", "root-wipe"},
+		{"bash", "echo 'unterminated\n", "confirm", "unchecked-script"},
+		{"python3", "print('hello')\n", "confirm", "unchecked-script"},
+		{"perl", "system('rm -rf /');\n", "confirm", "unchecked-script"},
+	} {
+		text := tc.interpreter + "\n" + tc.script
+		d := guard.DecideScript(tc.interpreter, tc.script, text)
+		if d.Action != tc.action || d.Rule != tc.rule {
+			t.Errorf("%s %q: decision = %+v, want %s %s", tc.interpreter, tc.script, d, tc.action, tc.rule)
+		}
+		err := guard.AuthorizeScript(ctx, []string{"web1"}, tc.interpreter, tc.script, text)
+		switch tc.action {
+		case "allow":
+			if err != nil {
+				t.Errorf("%q refused: %v", tc.script, err)
+			}
+		case "confirm":
+			if err == nil || !strings.Contains(err.Error(), "requires human approval") {
+				t.Errorf("%q without elicitation: %v", tc.script, err)
+			}
+		case "deny":
+			if err == nil || !strings.Contains(err.Error(), "denied by policy") {
+				t.Errorf("%q: %v", tc.script, err)
+			}
+		}
+	}
+
+	// Without rules there is nothing to check scripts against.
+	open := NewGuard(mcp.NewServer("test", "0"), &policy.Policy{})
+	if err := open.AuthorizeScript(ctx, []string{"web1"}, "python3", "print(1)", "python3\nprint(1)"); err != nil {
+		t.Errorf("no rules: %v", err)
+	}
+}
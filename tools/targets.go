@@ -0,0 +1,415 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/inventory"
+)
+
+const maxJumpDepth = 8
+
+// Targets resolves host names and selectors to executors and keeps the
+// connections opened by connect_ssh. The empty name stands for the default
+// host configured through the environment.
+type Targets struct {
+	// NewExecutor returns an unconnected executor for an inventory name, a
+	// host address or "".
+	NewExecutor func(name string) (executor.Executor, error)
+	// Logger receives connection events; nil discards them.
+	Logger *slog.Logger
+	// Changed is called after connections were opened or closed.
+	Changed func()
+
+	// The settings below may be changed through Reconfigure while the
+	// server runs.
+
+	Inventory *inventory.Inventory
+	// Groups maps extra group names to host addresses.
+	Groups map[string][]string
+	// Base holds the SSH settings that hosts do not override.
+	Base executor.SSHConfig
+	// SudoPassword is given to sudo for commands run with sudo: true.
+	SudoPassword string
+	// MaxOutputBytes limits each of stdout and stderr in command and script
+	// results; 0 means 1 MiB.
+	MaxOutputBytes int
+	// Concurrency is the default number of hosts execute_on_hosts runs on
+	// at once; 0 means 10.
+	Concurrency int
+	// ConnectTimeout limits opening a connection; 0 means no limit.
+	ConnectTimeout time.Duration
+	// CommandTimeout limits commands and scripts that set no timeout of
+	// their own; 0 means no limit.
+	CommandTimeout time.Duration
+
+	settings sync.RWMutex
+	mu       sync.Mutex
+	conns    map[string]executor.Executor
+	facts    map[string]cachedFacts
+}
+
+// NewTargets returns Targets creating SSH executors. Inventory hosts take
+// their settings from inv; other names are parsed as [user@]host[:port].
+// Settings missing from either fall back to base.
+func NewTargets(inv *inventory.Inventory, base executor.SSHConfig) *Targets {
+	t := &Targets{Inventory: inv, Base: base}
+	t.NewExecutor = func(name string) (executor.Executor, error) {
+		t.settings.RLock()
+		cfg, err := t.sshConfig(name, t.Base, 0)
+		t.settings.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		return executor.NewSSHExecutor(cfg), nil
+	}
+	return t
+}
+
+// Reconfigure calls update to change the settings of t while no tool reads
+// them. Open connections are kept with the settings they were opened with;
+// new connections use the updated ones.
+func (t *Targets) Reconfigure(update func(t *Targets)) {
+	t.settings.Lock()
+	defer t.settings.Unlock()
+	update(t)
+}
+
+// SSHConfig builds the connection settings for name on top of base.
+func (t *Targets) SSHConfig(name string, base executor.SSHConfig) (executor.SSHConfig, error) {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	return t.sshConfig(name, base, 0)
+}
+
+func (t *Targets) sshConfig(name string, base executor.SSHConfig, depth int) (executor.SSHConfig, error) {
+	if depth > maxJumpDepth {
+		return base, fmt.Errorf("jump host chain through %q is too long", name)
+	}
+	if name == "" {
+		return base, nil
+	}
+	h, ok := t.Inventory.Lookup(name)
+	if !ok {
+		return base.WithAddress(name)
+	}
+	cfg := base
+	cfg.Host = h.Address
+	if h.Port != 0 {
+		cfg.Port = h.Port
+	}
+	if h.User != "" {
+		cfg.User = h.User
+	}
+	if h.KeyPath != "" {
+		cfg.KeyPath = h.KeyPath
+		cfg.CertPath = ""
+	}
+	cfg.Jump = nil
+	if h.Jump != "" {
+		jump, err := t.sshConfig(h.Jump, base, depth+1)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Jump = &jump
+	}
+	return cfg, nil
+}
+
+// Resolve expands names, addresses and selectors (group:<name>,
+// tag:<key>[=<value>], all) into a de-duplicated list of hosts.
+func (t *Targets) Resolve(selectors []string) ([]string, error) {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	var hosts []string
+	seen := map[string]bool{}
+	add := func(names ...string) {
+		for _, n := range names {
+			if !seen[n] {
+				seen[n] = true
+				hosts = append(hosts, n)
+			}
+		}
+	}
+	for _, sel := range selectors {
+		if group, ok := strings.CutPrefix(sel, "group:"); ok && len(t.Groups[group]) > 0 {
+			add(t.Groups[group]...)
+			if members, err := t.Inventory.Select(sel); err == nil {
+				add(members...)
+			}
+			continue
+		}
+		if inventory.IsSelector(sel) {
+			if t.Inventory == nil {
+				return nil, fmt.Errorf("selector %q needs an inventory (set SSH_INVENTORY)", sel)
+			}
+			members, err := t.Inventory.Select(sel)
+			if err != nil {
+				return nil, err
+			}
+			add(members...)
+			continue
+		}
+		add(sel)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts given")
+	}
+	return hosts, nil
+}
+
+// Connect opens connections to every host matched by selector, replacing
+// existing connections to the same hosts. The empty selector connects the
+// default host.
+func (t *Targets) Connect(ctx context.Context, selector string) ([]string, error) {
+	hosts := []string{""}
+	if selector != "" {
+		var err error
+		if hosts, err = t.Resolve([]string{selector}); err != nil {
+			return nil, err
+		}
+	}
+
+	log := orDiscard(t.Logger).With("logger", "connection")
+	var connected []string
+	var errs []string
+	for _, host := range hosts {
+		exec, err := t.NewExecutor(host)
+		if err == nil {
+			err = t.connect(ctx, exec)
+		}
+		if err != nil {
+			log.Warn("connection failed", "host", displayName(host), "error", err)
+			if host == "" {
+				errs = append(errs, err.Error())
+			} else {
+				errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+			}
+			continue
+		}
+		t.mu.Lock()
+		if t.conns == nil {
+			t.conns = map[string]executor.Executor{}
+		}
+		old, reconnected := t.conns[host]
+		if reconnected {
+			old.Close()
+		}
+		t.conns[host] = exec
+		t.mu.Unlock()
+		if reconnected {
+			log.Info("reconnected", "host", displayName(host), "target", describeTarget(exec))
+		} else {
+			log.Info("connected", "host", displayName(host), "target", describeTarget(exec))
+		}
+		connected = append(connected, host)
+	}
+	if len(connected) > 0 {
+		t.changed()
+	}
+	if len(errs) > 0 {
+		return connected, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return connected, nil
+}
+
+// connect opens exec within the connect timeout.
+func (t *Targets) connect(ctx context.Context, exec executor.Executor) error {
+	if timeout, _ := t.timeouts(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return exec.Connect(ctx)
+}
+
+// Get returns the open connection for host and its name. With an empty host
+// it returns the default connection, or the only open connection if there is
+// just one.
+func (t *Targets) Get(host string) (string, executor.Executor, error) {
+	if inventory.IsSelector(host) {
+		return "", nil, fmt.Errorf("%q selects several hosts; name a single host", host)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if exec, ok := t.conns[host]; ok {
+		return host, exec, nil
+	}
+	if host != "" {
+		return "", nil, fmt.Errorf("%s: %w", host, executor.ErrNotConnected)
+	}
+	switch len(t.conns) {
+	case 0:
+		return "", nil, executor.ErrNotConnected
+	case 1:
+		for name, exec := range t.conns {
+			return name, exec, nil
+		}
+	}
+	names := t.connectedLocked()
+	for i, name := range names {
+		names[i] = displayName(name)
+	}
+	return "", nil, fmt.Errorf("several connections are open (%s); specify host", strings.Join(names, ", "))
+}
+
+// Disconnect closes the connections to the hosts matched by selector, or
+// all connections when selector is empty, and returns the names of the
+// hosts it disconnected.
+func (t *Targets) Disconnect(selector string) ([]string, error) {
+	var hosts []string
+	if selector != "" {
+		var err error
+		if hosts, err = t.Resolve([]string{selector}); err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	defer func() {
+		t.mu.Unlock()
+		t.changed()
+	}()
+	if selector == "" {
+		hosts = t.connectedLocked()
+	}
+	disconnected := []string{}
+	for _, host := range hosts {
+		if exec, ok := t.conns[host]; ok {
+			exec.Close()
+			delete(t.conns, host)
+			delete(t.facts, host)
+			disconnected = append(disconnected, displayName(host))
+			orDiscard(t.Logger).Info("disconnected", "logger", "connection", "host", displayName(host))
+		}
+	}
+	return disconnected, nil
+}
+
+func (t *Targets) CloseAll() {
+	t.Disconnect("")
+}
+
+// Connected returns the names of the open connections.
+func (t *Targets) Connected() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connectedLocked()
+}
+
+func (t *Targets) connectedLocked() []string {
+	names := make([]string, 0, len(t.conns))
+	for name := range t.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *Targets) changed() {
+	if t.Changed != nil {
+		t.Changed()
+	}
+}
+
+// needConnection fails when no connection is open.
+func (t *Targets) needConnection() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.conns) == 0 {
+		return fmt.Errorf("no open connection; call connect_ssh first")
+	}
+	return nil
+}
+
+// needTunnels fails when no open connection can carry tunnels.
+func (t *Targets) needTunnels() error {
+	if err := t.needConnection(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, exec := range t.conns {
+		if _, ok := exec.(executor.Tunneler); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("no open connection can carry tunnels")
+}
+
+// needHost fails when host is not connected.
+func (t *Targets) needHost(host string) func() error {
+	return func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.conns[host]; !ok {
+			return fmt.Errorf("%s is not connected; call connect_ssh with host %q first", host, host)
+		}
+		return nil
+	}
+}
+
+// needInventory fails when no inventory is configured.
+func (t *Targets) needInventory() error {
+	if t.inventory() == nil {
+		return fmt.Errorf("no inventory configured (set SSH_INVENTORY)")
+	}
+	return nil
+}
+
+func (t *Targets) inventory() *inventory.Inventory {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	return t.Inventory
+}
+
+func (t *Targets) sudoPassword() string {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	return t.SudoPassword
+}
+
+func (t *Targets) timeouts() (connect, command time.Duration) {
+	t.settings.RLock()
+	defer t.settings.RUnlock()
+	return t.ConnectTimeout, t.CommandTimeout
+}
+
+// withCommandTimeout bounds ctx by the command timeout, if one is set.
+func (t *Targets) withCommandTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, timeout := t.timeouts(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// describeTarget returns what exec connects to, if it says.
+func describeTarget(exec executor.Executor) string {
+	if s, ok := exec.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return ""
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// orDiscard returns l, or a logger discarding everything when l is nil.
+func orDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
+
+func displayName(host string) string {
+	if host == "" {
+		return "default"
+	}
+	return host
+}
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"ssh-executor/executor"
+	"ssh-executor/inventory"
+)
+
+func TestTargetsSSHConfig(t *testing.T) {
+	inv, err := inventory.New([]*inventory.Host{
+		{Name: "bastion", Address: "bastion.example.com", User: "jump"},
+		{Name: "web1", Address: "10.0.0.11", Port: 2222, Jump: "bastion", KeyPath: "/keys/web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := NewTargets(inv, executor.SSHConfig{Port: 22, User: "deploy", Password: "pw"})
+
+	cfg, err := targets.SSHConfig("web1", executor.SSHConfig{Port: 22, User: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "10.0.0.11" || cfg.Port != 2222 || cfg.User != "deploy" || cfg.KeyPath != "/keys/web" {
+		t.Errorf("web1 = %+v", cfg)
+	}
+	if cfg.Jump == nil || cfg.Jump.Host != "bastion.example.com" || cfg.Jump.User != "jump" || cfg.Jump.Port != 22 {
+		t.Errorf("web1 jump = %+v", cfg.Jump)
+	}
+
+	cfg, err = targets.SSHConfig("admin@10.9.9.9:2200", executor.SSHConfig{Port: 22, User: "deploy"})
+	if err != nil || cfg.Host != "10.9.9.9" || cfg.User != "admin" || cfg.Port != 2200 {
+		t.Errorf("address = %+v, %v", cfg, err)
+	}
+
+	if _, err := targets.Resolve([]string{"tag:env=prod"}); err == nil {
+		t.Error("selector matching nothing resolved")
+	}
+}
+
+func TestTargetsConnections(t *testing.T) {
+	fakes := map[string]*executor.Fake{}
+	targets := &Targets{NewExecutor: func(name string) (executor.Executor, error) {
+		if name == "down" {
+			return nil, errors.New("unreachable")
+		}
+		fakes[name] = executor.NewFake(nil)
+		return fakes[name], nil
+	}}
+	ctx := context.Background()
+
+	if _, _, err := targets.Get(""); !errors.Is(err, executor.ErrNotConnected) {
+		t.Errorf("get before connect: %v", err)
+	}
+	if _, err := targets.Connect(ctx, "web1"); err != nil {
+		t.Fatal(err)
+	}
+	if name, exec, err := targets.Get(""); err != nil || name != "web1" || exec != fakes["web1"] {
+		t.Errorf("single connection not used by default: %v", err)
+	}
+	if _, err := targets.Connect(ctx, "web2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := targets.Get(""); err == nil || !strings.Contains(err.Error(), "web1, web2") {
+		t.Errorf("ambiguous default: %v", err)
+	}
+	if _, exec, err := targets.Get("web2"); err != nil || exec != fakes["web2"] {
+		t.Errorf("get web2: %v", err)
+	}
+	if _, err := targets.Connect(ctx, "down"); err == nil {
+		t.Error("connect to failing host succeeded")
+	}
+
+	targets.Disconnect("web1")
+	if got := targets.Connected(); len(got) != 1 || got[0] != "web2" {
+		t.Errorf("connected after disconnect = %v", got)
+	}
+	targets.CloseAll()
+	if got := targets.Connected(); len(got) != 0 {
+		t.Errorf("connected after CloseAll = %v", got)
+	}
+}
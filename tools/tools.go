@@ -0,0 +1,282 @@
+// Package tools registers the SSH executor tools on an MCP server.
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/shell"
+)
+
+type ConnectArgs struct {
+	Host string `json:"host,omitempty" description:"Inventory host, selector (group:<name>, tag:<key>=<value>, all) or [user@]host[:port]; defaults to the configured SSH_HOST"`
+}
+
+type ExecuteCommandArgs struct {
+	Host     string            `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to the only open connection"`
+	Command  string            `json:"command,omitempty" description:"Shell command to execute; give either command or argv"`
+	Argv     []string          `json:"argv,omitempty" description:"Program and arguments, e.g. [\"grep\", \"-r\", pattern, dir]; each word is passed verbatim, no quoting needed"`
+	NoShell  bool              `json:"no_shell,omitempty" description:"With argv, start the program directly where the transport allows; over SSH argv is always exec'd with every word quoted"`
+	Env      map[string]string `json:"env,omitempty" description:"Environment variables for the command; values are passed verbatim, no quoting needed"`
+	Cwd      string            `json:"cwd,omitempty" description:"Working directory for the command (default: the login directory)"`
+	Sudo     bool              `json:"sudo,omitempty" description:"Run the command through sudo using the password configured on the server"`
+	SudoUser string            `json:"sudo_user,omitempty" description:"User to run as with sudo (default root); implies sudo"`
+	DryRun   bool              `json:"dry_run,omitempty" description:"Only report what would run: target, policy decision, programs, files and redirections"`
+}
+
+type DisconnectArgs struct {
+	Host string `json:"host,omitempty" description:"Inventory host or selector to disconnect; defaults to all connections"`
+}
+
+type UploadFileArgs struct {
+	Host     string `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to the only open connection"`
+	Path     string `json:"path" description:"Destination path on the remote host"`
+	Content  string `json:"content" description:"File content"`
+	Encoding string `json:"encoding,omitempty" enum:"utf-8|base64" description:"Encoding of content (default utf-8)"`
+	Mode     string `json:"mode,omitempty" description:"Octal file mode, e.g. 0644 (default: keep existing or umask)"`
+	DryRun   bool   `json:"dry_run,omitempty" description:"Only report what would happen; nothing is run on the host"`
+}
+
+type DownloadFileArgs struct {
+	Host   string `json:"host,omitempty" description:"Inventory host name or [user@]host[:port]; defaults to the only open connection"`
+	Path   string `json:"path" description:"Path of the file on the remote host"`
+	DryRun bool   `json:"dry_run,omitempty" description:"Only report what would happen; nothing is read from the host"`
+}
+
+// Register adds the connection, command and file tools to s, all operating
+// on the connections held by t. Commands are authorized by g.
+func Register(s *mcp.Server, t *Targets, g *Guard) {
+	mcp.AddTool(s, "connect_ssh", "Connect to SSH server", func(ctx context.Context, args ConnectArgs) (*mcp.CallToolResult, error) {
+		connected, err := t.Connect(ctx, args.Host)
+		out := ConnectOutput{Connected: make([]string, len(connected))}
+		for i, host := range connected {
+			out.Connected[i] = displayName(host)
+		}
+		if err != nil {
+			res := mcp.ErrorResult(fmt.Sprintf("Connection failed: %v", err))
+			if len(connected) > 0 {
+				res = mcp.ErrorResult(fmt.Sprintf("Connected to %s\nConnection failed: %v", strings.Join(connected, ", "), err))
+			}
+			res.StructuredContent = out
+			return res, nil
+		}
+		if args.Host == "" {
+			return mcp.StructuredResult("Connected to SSH server", out), nil
+		}
+		return mcp.StructuredResult(fmt.Sprintf("Connected to %s", strings.Join(connected, ", ")), out), nil
+	}, mcp.WithOutput[ConnectOutput](), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(false),
+		IdempotentHint:  mcp.Bool(true),
+	}))
+
+	mcp.AddTool(s, "execute_command", "Execute command on remote server", func(ctx context.Context, args ExecuteCommandArgs) (*mcp.CallToolResult, error) {
+		if err := executor.CheckEnv(args.Env); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		if err := checkCommandArgs(args); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		cmd := args.Command
+		if len(args.Argv) > 0 {
+			cmd = shell.Join(args.Argv)
+		}
+		useSudo := args.Sudo || args.SudoUser != ""
+		if useSudo {
+			cmd = sudoDisplay(cmd, args.SudoUser)
+		}
+		if args.DryRun {
+			plan := newPlan("execute_command", t, args.Host)
+			plan.describeCommand(g, cmd)
+			plan.describeEnv(args.Env, args.Cwd)
+			if useSudo && t.sudoPassword() == "" {
+				plan.Warnings = append(plan.Warnings, "no sudo password is configured; sudo runs non-interactively and fails if it needs one")
+			}
+			return planResult(plan)
+		}
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		if err := g.Authorize(ctx, []string{host}, cmd); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command refused: %v", err)), nil
+		}
+		ctx, cancel := t.withCommandTimeout(ctx)
+		defer cancel()
+		opts := executor.RunOptions{Env: args.Env, Dir: args.Cwd}
+		sudo := executor.Sudo{User: args.SudoUser, Password: t.sudoPassword()}
+		var res *executor.Result
+		switch {
+		case useSudo && len(args.Argv) > 0:
+			res, err = sudo.Run(ctx, exec, "exec "+shell.Join(args.Argv), opts)
+		case useSudo:
+			res, err = sudo.Run(ctx, exec, args.Command, opts)
+		case args.NoShell:
+			res, err = executor.RunArgv(ctx, exec, args.Argv, opts)
+		case len(args.Argv) > 0:
+			res, err = exec.Run(ctx, "exec "+shell.Join(args.Argv), opts)
+		default:
+			res, err = exec.Run(ctx, args.Command, opts)
+		}
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Command failed: %v", err)), nil
+		}
+		return commandResult(commandOutput(host, res, t.maxOutput()), t.maxOutput()), nil
+	}, withPlan[CommandOutput](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+	}))
+
+	mcp.AddTool(s, "upload_file", "Write a file on the remote server", func(ctx context.Context, args UploadFileArgs) (*mcp.CallToolResult, error) {
+		data, mode, err := decodeUpload(args)
+		if err != nil {
+			return mcp.ErrorResult(err.Error()), nil
+		}
+		if args.DryRun {
+			plan := newPlan("upload_file", t, args.Host)
+			plan.Files = []string{args.Path}
+			plan.Transfer = &TransferPlan{Direction: "upload", Path: args.Path, Bytes: len(data)}
+			if mode != 0 {
+				plan.Transfer.Mode = fmt.Sprintf("%04o", mode)
+			}
+			return planResult(plan)
+		}
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Upload failed: %v", err)), nil
+		}
+		if err := exec.Upload(ctx, args.Path, data, mode); err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Upload failed: %v", err)), nil
+		}
+		out := UploadOutput{Host: displayName(host), Path: args.Path, Bytes: len(data)}
+		return mcp.StructuredResult(fmt.Sprintf("Wrote %d bytes to %s", len(data), args.Path), out), nil
+	}, withPlan[UploadOutput](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(true),
+		IdempotentHint:  mcp.Bool(true),
+	}))
+
+	mcp.AddTool(s, "download_file", "Read a file from the remote server", func(ctx context.Context, args DownloadFileArgs) (*mcp.CallToolResult, error) {
+		if args.DryRun {
+			plan := newPlan("download_file", t, args.Host)
+			plan.Files = []string{args.Path}
+			plan.Transfer = &TransferPlan{Direction: "download", Path: args.Path}
+			return planResult(plan)
+		}
+		host, exec, err := t.Get(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Download failed: %v", err)), nil
+		}
+		data, err := exec.Download(ctx, args.Path)
+		if err != nil {
+			return mcp.ErrorResult(fmt.Sprintf("Download failed: %v", err)), nil
+		}
+		out := DownloadOutput{Host: displayName(host), Path: args.Path, Content: string(data), Encoding: "utf-8", Bytes: len(data)}
+		if !utf8.Valid(data) {
+			out.Content = base64.StdEncoding.EncodeToString(data)
+			out.Encoding = "base64"
+			return mcp.StructuredResult(fmt.Sprintf("base64:%s", out.Content), out), nil
+		}
+		return mcp.StructuredResult(out.Content, out), nil
+	}, withPlan[DownloadOutput](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint: mcp.Bool(true),
+	}))
+
+	mcp.AddTool(s, "disconnect_ssh", "Disconnect from SSH server", func(ctx context.Context, args DisconnectArgs) (*mcp.CallToolResult, error) {
+		disconnected, err := t.Disconnect(args.Host)
+		if err != nil {
+			return mcp.ErrorResult(err.Error()), nil
+		}
+		return mcp.StructuredResult("Disconnected from SSH server", DisconnectOutput{Disconnected: disconnected}), nil
+	}, mcp.WithOutput[DisconnectOutput](), mcp.WithAvailability(t.needConnection), mcp.WithAnnotations(mcp.ToolAnnotations{
+		ReadOnlyHint:    mcp.Bool(false),
+		DestructiveHint: mcp.Bool(false),
+		IdempotentHint:  mcp.Bool(true),
+		OpenWorldHint:   mcp.Bool(false),
+	}))
+}
+
+// commandOutput converts res to the structured result of a command run on
+// host, cutting each stream to limit bytes.
+func commandOutput(host string, res *executor.Result, limit int) CommandOutput {
+	out := CommandOutput{Host: displayName(host), ExitCode: res.ExitCode, DurationMs: res.Duration.Milliseconds()}
+	var cutOut, cutErr bool
+	out.Stdout, cutOut = truncateOutput(res.Stdout, limit)
+	out.Stderr, cutErr = truncateOutput(res.Stderr, limit)
+	out.Truncated = cutOut || cutErr
+	return out
+}
+
+// commandResult is the tool result for out: its output as text, failed if
+// the command exited non-zero, with out as structured content.
+func commandResult(out CommandOutput, limit int) *mcp.CallToolResult {
+	var result *mcp.CallToolResult
+	if out.ExitCode != 0 {
+		result = mcp.ErrorResult(fmt.Sprintf("Command failed: exit status %d\nOutput: %s\nError: %s", out.ExitCode, out.Stdout, out.Stderr))
+	} else {
+		result = mcp.TextResult(fmt.Sprintf("Output:\n%s", out.Stdout))
+	}
+	if out.Truncated {
+		result.Content[0].Text += truncatedNote(limit)
+	}
+	result.StructuredContent = out
+	return result
+}
+
+// checkCommandArgs requires exactly one of command and argv, and refuses
+// options that cannot be honoured together.
+func checkCommandArgs(args ExecuteCommandArgs) error {
+	switch {
+	case args.Command == "" && len(args.Argv) == 0:
+		return fmt.Errorf("command or argv parameter required")
+	case args.Command != "" && len(args.Argv) > 0:
+		return fmt.Errorf("give either command or argv, not both")
+	case len(args.Argv) > 0 && args.Argv[0] == "":
+		return fmt.Errorf("argv[0] must name a program")
+	case args.NoShell && len(args.Argv) == 0:
+		return fmt.Errorf("no_shell needs argv")
+	case args.NoShell && (args.Sudo || args.SudoUser != ""):
+		return fmt.Errorf("no_shell cannot be combined with sudo, which runs the command through sh")
+	}
+	return nil
+}
+
+// sudoDisplay is how a sudo command is shown to the policy and to the human
+// approving it.
+func sudoDisplay(cmd, user string) string {
+	if user == "" {
+		return "sudo " + cmd
+	}
+	return fmt.Sprintf("sudo -u %s %s", shell.Quote(user), cmd)
+}
+
+func decodeUpload(args UploadFileArgs) ([]byte, os.FileMode, error) {
+	data := []byte(args.Content)
+	switch args.Encoding {
+	case "", "utf-8":
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(args.Content)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid base64 content: %v", err)
+		}
+		data = decoded
+	default:
+		return nil, 0, fmt.Errorf("unsupported encoding %q", args.Encoding)
+	}
+	var mode os.FileMode
+	if args.Mode != "" {
+		m, err := strconv.ParseUint(args.Mode, 8, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid mode %q", args.Mode)
+		}
+		mode = os.FileMode(m)
+	}
+	return data, mode, nil
+}
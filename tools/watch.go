@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-executor/executor"
+	"ssh-executor/mcp"
+	"ssh-executor/shell"
+)
+
+const (
+	// watchInterval is how often watched files are polled when inotifywait
+	// is not installed on the host.
+	watchInterval = 2 * time.Second
+	// inotifyTimeout bounds each inotifywait call so that a stopped watch
+	// does not leave it running for long.
+	inotifyTimeout = 30
+)
+
+// fileWatcher watches remote files for resource subscriptions. A watch waits
+// for inotifywait to report an event, or for the poll interval when it is not
+// installed, then compares the file's inode, size and modification time over
+// the host's current connection.
+type fileWatcher struct {
+	t        *Targets
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches map[string]context.CancelFunc
+}
+
+func newFileWatcher(t *Targets, interval time.Duration) *fileWatcher {
+	return &fileWatcher{t: t, interval: interval, watches: map[string]context.CancelFunc{}}
+}
+
+// fileState is what a watch compares between checks.
+type fileState struct {
+	exists bool
+	inode  string
+	size   int64
+	mtime  string
+}
+
+func (w *fileWatcher) Watch(uri string, changed func(meta map[string]interface{})) error {
+	if _, ok := mcp.MatchTemplate(factsTemplate, uri); ok {
+		return fmt.Errorf("only file resources can be watched")
+	}
+	vars, ok := mcp.MatchTemplate(fileTemplate, uri)
+	if !ok {
+		return fmt.Errorf("not a file resource: %s", uri)
+	}
+	host, p, _, err := resourceFile(vars)
+	if err != nil {
+		return err
+	}
+	if _, _, err := w.t.Get(host); err != nil {
+		return err
+	}
+	base, _, _ := strings.Cut(uri, "?")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.mu.Lock()
+	if old, ok := w.watches[uri]; ok {
+		old()
+	}
+	w.watches[uri] = cancel
+	w.mu.Unlock()
+
+	last, _ := w.stat(ctx, host, p)
+	go w.run(ctx, host, p, base, last, changed)
+	return nil
+}
+
+func (w *fileWatcher) Unwatch(uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cancel, ok := w.watches[uri]; ok {
+		cancel()
+		delete(w.watches, uri)
+	}
+}
+
+// run reports changes of p until ctx is cancelled. When the file grew in
+// place, the notification points at the resource URI for the appended bytes.
+func (w *fileWatcher) run(ctx context.Context, host, p, uri string, last fileState, changed func(meta map[string]interface{})) {
+	for {
+		w.wait(ctx, host, p)
+		if ctx.Err() != nil {
+			return
+		}
+		cur, err := w.stat(ctx, host, p)
+		if err != nil || cur == last {
+			continue
+		}
+		meta := map[string]interface{}{"size": cur.size}
+		switch {
+		case !cur.exists:
+			meta["deleted"] = true
+		case last.exists && cur.inode == last.inode && cur.size > last.size:
+			meta["appended_bytes"] = cur.size - last.size
+			meta["appended_uri"] = fmt.Sprintf("%s?offset=%d", uri, last.size)
+		}
+		last = cur
+		changed(meta)
+	}
+}
+
+// wait blocks until p may have changed.
+func (w *fileWatcher) wait(ctx context.Context, host, p string) {
+	_, exec, err := w.t.Get(host)
+	if err == nil {
+		cmd := fmt.Sprintf("command -v inotifywait >/dev/null || exit 127\nexec inotifywait -qq -t %d -e modify,attrib,close_write,move_self,delete_self %s",
+			inotifyTimeout, shell.Quote(p))
+		res, err := exec.Run(ctx, cmd, executor.RunOptions{})
+		// inotifywait exits with 0 on an event and 2 on timeout.
+		if err == nil && (res.ExitCode == 0 || res.ExitCode == 2) {
+			return
+		}
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(w.interval):
+	}
+}
+
+func (w *fileWatcher) stat(ctx context.Context, host, p string) (fileState, error) {
+	_, exec, err := w.t.Get(host)
+	if err != nil {
+		return fileState{}, err
+	}
+	q := shell.Quote(p)
+	cmd := fmt.Sprintf("[ -e %s ] || exit 0\nstat -L -c '%%i %%s %%Y' %s 2>/dev/null || stat -L -f '%%i %%z %%m' %s", q, q, q)
+	res, err := exec.Run(ctx, cmd, executor.RunOptions{})
+	if err != nil {
+		return fileState{}, err
+	}
+	if res.ExitCode != 0 {
+		return fileState{}, fmt.Errorf("stat %s: %s", p, strings.TrimSpace(res.Stderr))
+	}
+	return parseStat(res.Stdout)
+}
+
+func parseStat(out string) (fileState, error) {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return fileState{}, nil
+	}
+	if len(fields) != 3 {
+		return fileState{}, fmt.Errorf("unexpected stat output %q", out)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fileState{}, fmt.Errorf("unexpected stat output %q", out)
+	}
+	return fileState{exists: true, inode: fields[0], size: size, mtime: fields[2]}, nil
+}
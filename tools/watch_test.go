@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ssh-executor/executor"
+)
+
+func TestFileWatcher(t *testing.T) {
+	targets := &Targets{NewExecutor: func(name string) (executor.Executor, error) {
+		return executor.NewLocalExecutor(), nil
+	}}
+	if _, err := targets.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(file, []byte("one\n"), 0644)
+
+	w := newFileWatcher(targets, 10*time.Millisecond)
+	if err := w.Watch("ssh://default/facts", nil); err == nil {
+		t.Error("watching facts succeeded")
+	}
+	events := make(chan map[string]interface{}, 10)
+	uri := "ssh://default" + file
+	if err := w.Watch(uri, func(meta map[string]interface{}) { events <- meta }); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Unwatch(uri)
+
+	next := func() map[string]interface{} {
+		t.Helper()
+		select {
+		case meta := <-events:
+			return meta
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change reported")
+			return nil
+		}
+	}
+
+	f, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("two\n")
+	f.Close()
+	meta := next()
+	if meta["appended_uri"] != uri+"?offset=4" || meta["appended_bytes"] != int64(4) {
+		t.Errorf("append: %v", meta)
+	}
+	data, err := readFile(context.Background(), executor.NewLocalExecutor(), file, 4)
+	if err != nil || string(data) != "two\n" {
+		t.Errorf("read from offset: %q, %v", data, err)
+	}
+
+	os.Remove(file)
+	if meta := next(); meta["deleted"] != true {
+		t.Errorf("delete: %v", meta)
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	st, err := parseStat("1234 56 1700000000\n")
+	if err != nil || st != (fileState{exists: true, inode: "1234", size: 56, mtime: "1700000000"}) {
+		t.Errorf("parseStat = %+v, %v", st, err)
+	}
+	if st, err := parseStat(""); err != nil || st.exists {
+		t.Errorf("missing file = %+v, %v", st, err)
+	}
+}